@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// Charts are drawn in Go Regular, which covers Cyrillic, so captions come
+// from the chat's message catalog.
+const (
+	chartWidth     = 800
+	chartPadding   = 20
+	chartRowHeight = 28
+	chartBarHeight = 18
+	chartLabelSize = 160
+	chartValueSize = 110
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartText       = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	chartPositive   = color.RGBA{0x4c, 0xaf, 0x50, 0xff}
+	chartNegative   = color.RGBA{0xe5, 0x39, 0x35, 0xff}
+	chartSecondary  = color.RGBA{0x42, 0xa5, 0xf5, 0xff}
+)
+
+// chartFont is parsed once. A face made from it keeps scratch buffers, so
+// every chart opens a face of its own.
+var chartFont = func() *opentype.Font {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
+
+// chartBar is a single labelled value on a bar chart. Values are in kopecks.
+type chartBar struct {
+	Label string
+	Value int
+	Color color.Color
+}
+
+// chartGroup is a set of bars drawn next to each other under one label
+type chartGroup struct {
+	Label string
+	Bars  []chartBar
+}
+
+// renderBarChart draws horizontal bar groups growing left or right from a
+// common zero axis and encodes the result as PNG.
+func renderBarChart(title string, legend []chartBar, groups []chartGroup) ([]byte, error) {
+	face, err := opentype.NewFace(chartFont, &opentype.FaceOptions{Size: 13, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	rows := 0
+	maxValue := 0
+	hasNegative := false
+	for _, group := range groups {
+		rows += len(group.Bars)
+		for _, bar := range group.Bars {
+			value := bar.Value
+			if value < 0 {
+				value = -value
+				hasNegative = true
+			}
+			if value > maxValue {
+				maxValue = value
+			}
+		}
+	}
+	if maxValue == 0 {
+		maxValue = 1
+	}
+
+	header := 2 * chartRowHeight
+	if len(legend) > 0 {
+		header += chartRowHeight
+	}
+	height := header + rows*chartRowHeight + len(groups)*chartRowHeight/2 + chartPadding
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	drawChartText(img, face, chartPadding, chartPadding+13, title, chartText)
+	if len(legend) > 0 {
+		x := chartPadding
+		for _, item := range legend {
+			fillRect(img, x, chartPadding+chartRowHeight+2, x+12, chartPadding+chartRowHeight+14, item.Color)
+			drawChartText(img, face, x+18, chartPadding+chartRowHeight+13, item.Label, chartText)
+			x += 36 + font.MeasureString(face, item.Label).Ceil()
+		}
+	}
+
+	plotLeft := chartPadding + chartLabelSize
+	plotRight := chartWidth - chartPadding - chartValueSize
+	zero := plotLeft
+	if hasNegative {
+		zero = (plotLeft + plotRight) / 2
+	}
+	scale := float64(plotRight-zero) / float64(maxValue)
+
+	y := header
+	for _, group := range groups {
+		drawChartText(img, face, chartPadding, y+chartBarHeight-4, truncateLabel(face, group.Label, chartLabelSize), chartText)
+		for _, bar := range group.Bars {
+			length := int(float64(bar.Value) * scale)
+			if bar.Value < 0 {
+				fillRect(img, zero+length, y, zero, y+chartBarHeight, bar.Color)
+			} else {
+				fillRect(img, zero, y, zero+length, y+chartBarHeight, bar.Color)
+			}
+			drawChartText(img, face, plotRight+8, y+chartBarHeight-4, formatMoney(bar.Value), chartText)
+			y += chartRowHeight
+		}
+		y += chartRowHeight / 2
+	}
+	fillRect(img, zero, header-4, zero+1, y, chartAxis)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderBalanceChart draws the net position of every member of a chat
+func renderBalanceChart(lang i18n.Lang, balances []ledger.Balance) ([]byte, error) {
+	net := make(map[string]int)
+	for _, balance := range balances {
+		net[balance.Creditor] += balance.Amount
+		net[balance.Debtor] -= balance.Amount
+	}
+
+	var groups []chartGroup
+	for user, amount := range net {
+		if amount == 0 {
+			continue
+		}
+		barColor := chartPositive
+		if amount < 0 {
+			barColor = chartNegative
+		}
+		groups = append(groups, chartGroup{Label: user, Bars: []chartBar{{Value: amount, Color: barColor}}})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Bars[0].Value > groups[j].Bars[0].Value
+	})
+
+	legend := []chartBar{
+		{Label: lang.T("chart.owed"), Color: chartPositive},
+		{Label: lang.T("chart.owes"), Color: chartNegative},
+	}
+	return renderBarChart(lang.T("chart.balance"), legend, groups)
+}
+
+// renderSpendingChart draws how much every member paid and consumed
+func renderSpendingChart(lang i18n.Lang, members []storage.MemberStats, days int) ([]byte, error) {
+	var groups []chartGroup
+	for _, member := range members {
+		groups = append(groups, chartGroup{
+			Label: member.User,
+			Bars: []chartBar{
+				{Value: member.Paid, Color: chartPositive},
+				{Value: member.Consumed, Color: chartSecondary},
+			},
+		})
+	}
+
+	legend := []chartBar{
+		{Label: lang.T("chart.paid"), Color: chartPositive},
+		{Label: lang.T("chart.consumed"), Color: chartSecondary},
+	}
+	return renderBarChart(lang.T("chart.spending", describePeriod(lang, days)), legend, groups)
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func drawChartText(img *image.RGBA, face font.Face, x, y int, text string, c color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// truncateLabel shortens a label so that it fits into width pixels
+func truncateLabel(face font.Face, label string, width int) string {
+	runes := []rune(label)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)).Ceil() > width-8 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/storage"
+)
+
+// defaultConfigPath is read if it exists and no other file is given with -config
+const defaultConfigPath = "config.yaml"
+
+// config is the bot configuration. Values come from the defaults, then the
+// config file, then environment variables (including .env), then flags.
+type config struct {
+	Token       string `yaml:"token"`
+	APIEndpoint string `yaml:"api_endpoint"`
+	Database    string `yaml:"database"`
+
+	Debug    bool   `yaml:"debug"`     // log every Bot API request
+	LogLevel string `yaml:"log_level"` // debug, info, warn or error
+
+	AllowedChats []int64  `yaml:"allowed_chats"` // group chats served; empty means all
+	Admins       []string `yaml:"admins"`        // usernames allowed to cancel anyone's operation
+	Women        []string `yaml:"women"`         // deprecated: usernames copied to /gender f at startup
+	Currency     string   `yaml:"currency"`
+	Locale       string   `yaml:"locale"`
+	DigestHour   int      `yaml:"digest_hour"` // hour of the server's day daily notification digests are sent
+
+	Workers         int           `yaml:"workers"`
+	QueueSize       int           `yaml:"queue_size"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Webhook webhookConfig `yaml:"webhook"`
+}
+
+// currencySymbols are the supported currencies and how amounts in them are shown
+var currencySymbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+}
+
+// supportedLocales are the languages the bot can answer in. Locale is the
+// default, chats choose another one with /lang.
+var supportedLocales = []string{string(i18n.Russian), string(i18n.English)}
+
+// cfg is the configuration in effect. Until main loads it, it holds the defaults.
+var cfg = defaultConfig()
+
+func defaultConfig() config {
+	return config{
+		Database:        storage.DefaultURL,
+		LogLevel:        "info",
+		Currency:        "RUB",
+		Locale:          "ru",
+		DigestHour:      20,
+		Workers:         8,
+		QueueSize:       64,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// loadConfig reads the config file at path on top of the defaults and applies
+// the environment. A missing file is only an error if required is set.
+func loadConfig(path string, required bool) (config, error) {
+	c := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !required:
+	case err != nil:
+		return c, err
+	default:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(c.Women) > 0 {
+			log.Printf("%s: women is deprecated, users now choose their gender with /gender", path)
+		}
+	}
+
+	if err := c.applyEnv(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set
+func (c *config) applyEnv() error {
+	vars := map[string]*string{
+		"TELEGRAM_BOT_TOKEN":    &c.Token,
+		"TELEGRAM_API_ENDPOINT": &c.APIEndpoint,
+		"DATABASE_URL":          &c.Database,
+		"LOG_LEVEL":             &c.LogLevel,
+		"CURRENCY":              &c.Currency,
+		"LOCALE":                &c.Locale,
+		"WEBHOOK_LISTEN":        &c.Webhook.Listen,
+		"WEBHOOK_PATH_SECRET":   &c.Webhook.PathSecret,
+		"WEBHOOK_SECRET_TOKEN":  &c.Webhook.SecretToken,
+		"WEBHOOK_CERT":          &c.Webhook.CertFile,
+		"WEBHOOK_KEY":           &c.Webhook.KeyFile,
+		"WEBHOOK_URL":           &c.Webhook.PublicURL,
+	}
+	for name, value := range vars {
+		if env, ok := os.LookupEnv(name); ok {
+			*value = env
+		}
+	}
+
+	if env, ok := os.LookupEnv("DEBUG"); ok {
+		debug, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("DEBUG: %w", err)
+		}
+		c.Debug = debug
+	}
+	if env, ok := os.LookupEnv("DIGEST_HOUR"); ok {
+		hour, err := strconv.Atoi(env)
+		if err != nil {
+			return fmt.Errorf("DIGEST_HOUR: %w", err)
+		}
+		c.DigestHour = hour
+	}
+	if env, ok := os.LookupEnv("ALLOWED_CHATS"); ok {
+		c.AllowedChats = nil
+		for _, field := range splitList(env) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("ALLOWED_CHATS: %q is not a chat ID", field)
+			}
+			c.AllowedChats = append(c.AllowedChats, id)
+		}
+	}
+	if env, ok := os.LookupEnv("ADMIN_USERS"); ok {
+		c.Admins = splitList(env)
+	}
+	for _, name := range []string{"WOMEN", "SKIBIDI_WOMEN"} {
+		if env, ok := os.LookupEnv(name); ok {
+			log.Printf("%s is deprecated, users now choose their gender with /gender", name)
+			c.Women = splitList(env)
+			break
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validate checks the configuration and normalises usernames
+func (c *config) validate() error {
+	var problems []string
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown log level %q, use debug, info, warn or error", c.LogLevel))
+	}
+	if _, ok := currencySymbols[c.Currency]; !ok {
+		problems = append(problems, fmt.Sprintf("unsupported currency %q", c.Currency))
+	}
+	if !containsString(supportedLocales, c.Locale) {
+		problems = append(problems, fmt.Sprintf("unsupported locale %q, use one of %s", c.Locale, strings.Join(supportedLocales, ", ")))
+	}
+	if c.DigestHour < 0 || c.DigestHour > 23 {
+		problems = append(problems, "digest_hour must be between 0 and 23")
+	}
+	if c.Database == "" {
+		problems = append(problems, "database is not set")
+	}
+	if c.Workers < 1 || c.QueueSize < 1 {
+		problems = append(problems, "workers and queue_size must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown_timeout must be positive")
+	}
+	for _, id := range c.AllowedChats {
+		if id == 0 {
+			problems = append(problems, "allowed_chats contains 0")
+		}
+	}
+	if (c.Webhook.CertFile == "") != (c.Webhook.KeyFile == "") {
+		problems = append(problems, "webhook cert_file and key_file must be set together")
+	}
+	// Anyone who finds the webhook could post updates to it otherwise
+	if c.Webhook.Listen != "" && strings.Trim(c.Webhook.PathSecret, "/") == "" && c.Webhook.SecretToken == "" {
+		problems = append(problems, "webhook listen requires path_secret or secret_token")
+	}
+	for _, names := range []*[]string{&c.Admins, &c.Women} {
+		for i, name := range *names {
+			(*names)[i] = strings.TrimPrefix(strings.TrimSpace(name), "@")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// chatAllowed reports whether the bot serves a chat. Private chats are always served.
+func (c *config) chatAllowed(chatID int64, private bool) bool {
+	if private || len(c.AllowedChats) == 0 {
+		return true
+	}
+	for _, id := range c.AllowedChats {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether a user is one of the bot admins
+func (c *config) isAdmin(username string) bool {
+	return username != "" && containsString(c.Admins, username)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
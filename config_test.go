@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+func TestValidateWebhookSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook webhookConfig
+		ok      bool
+	}{
+		{"polling", webhookConfig{}, true},
+		{"no secret", webhookConfig{Listen: ":8443"}, false},
+		{"slashes only", webhookConfig{Listen: ":8443", PathSecret: "/"}, false},
+		{"path secret", webhookConfig{Listen: ":8443", PathSecret: "hook-3f9a"}, true},
+		{"secret token", webhookConfig{Listen: ":8443", SecretToken: "s3cret"}, true},
+	}
+	for _, test := range tests {
+		c := defaultConfig()
+		c.Webhook = test.webhook
+		err := c.validate()
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && (err == nil || !strings.Contains(err.Error(), "path_secret or secret_token")) {
+			t.Errorf("%s: got %v, want a missing secret", test.name, err)
+		}
+	}
+}
+
+// configEnv are the environment variables applyEnv reads
+var configEnv = []string{
+	"TELEGRAM_BOT_TOKEN", "TELEGRAM_API_ENDPOINT", "DATABASE_URL", "LOG_LEVEL", "CURRENCY", "LOCALE",
+	"WEBHOOK_LISTEN", "WEBHOOK_PATH_SECRET", "WEBHOOK_SECRET_TOKEN", "WEBHOOK_CERT", "WEBHOOK_KEY", "WEBHOOK_URL",
+	"DEBUG", "DIGEST_HOUR", "ALLOWED_CHATS", "ADMIN_USERS", "WOMEN", "SKIBIDI_WOMEN",
+}
+
+// configFlags registers the configuration flags on a new flag set and parses
+// args with it. Registering resets the flags to their defaults.
+func configFlags(args []string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet("obshyakBot3", flag.ContinueOnError)
+	fs.BoolVar(inMemory, "memory", false, "")
+	fs.StringVar(configPath, "config", defaultConfigPath, "")
+	fs.StringVar(database, "database", defaultConfig().Database, "")
+	fs.BoolVar(debug, "debug", false, "")
+	fs.StringVar(logLevelName, "log-level", defaultConfig().LogLevel, "")
+	fs.IntVar(workers, "workers", defaultConfig().Workers, "")
+	fs.IntVar(queueSize, "queue-size", defaultConfig().QueueSize, "")
+	fs.DurationVar(shutdownTimeout, "shutdown-timeout", defaultConfig().ShutdownTimeout, "")
+	return fs, fs.Parse(args)
+}
+
+// runSetupConfig runs setupConfig in a directory holding files, with only env
+// set and args on the command line, and returns the configuration it loaded
+func runSetupConfig(t *testing.T, files, env map[string]string, args []string) (config, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// t.Setenv restores the variables, including those .env sets
+	for _, name := range configEnv {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	fs, err := configFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandLine := flag.CommandLine
+	flag.CommandLine = fs
+	previous := cfg
+	t.Cleanup(func() {
+		flag.CommandLine = commandLine
+		configFlags(nil)
+		cfg = previous
+	})
+
+	cfg = defaultConfig()
+	err = setupConfig()
+	return cfg, err
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		args  []string
+		want  func(c *config)
+	}{
+		{
+			name: "defaults",
+			want: func(c *config) {},
+		},
+		{
+			name: "file over defaults",
+			files: map[string]string{"config.yaml": "log_level: warn\nworkers: 2\ncurrency: EUR\n" +
+				"shutdown_timeout: 5s\nallowed_chats: [-100]\nadmins: [\"@anna\"]\n"},
+			want: func(c *config) {
+				c.LogLevel = "warn"
+				c.Workers = 2
+				c.Currency = "EUR"
+				c.ShutdownTimeout = 5 * time.Second
+				c.AllowedChats = []int64{-100}
+				c.Admins = []string{"anna"}
+			},
+		},
+		{
+			name:  "empty file",
+			files: map[string]string{"config.yaml": ""},
+			want:  func(c *config) {},
+		},
+		{
+			name: "file given with -config",
+			files: map[string]string{
+				"config.yaml": "currency: EUR\n",
+				"other.yaml":  "currency: USD\n",
+			},
+			args: []string{"-config", "other.yaml"},
+			want: func(c *config) { c.Currency = "USD" },
+		},
+		{
+			name: ".env over file",
+			files: map[string]string{
+				"config.yaml": "log_level: warn\ndigest_hour: 9\n",
+				".env":        "LOG_LEVEL=error\nDIGEST_HOUR=21\nTELEGRAM_BOT_TOKEN=123:abc\n",
+			},
+			want: func(c *config) {
+				c.LogLevel = "error"
+				c.DigestHour = 21
+				c.Token = "123:abc"
+			},
+		},
+		{
+			name:  "environment over .env",
+			files: map[string]string{".env": "LOG_LEVEL=error\nCURRENCY=EUR\n"},
+			env:   map[string]string{"LOG_LEVEL": "debug"},
+			want: func(c *config) {
+				c.LogLevel = "debug"
+				c.Currency = "EUR"
+			},
+		},
+		{
+			name:  "environment lists",
+			files: map[string]string{"config.yaml": "allowed_chats: [-1]\nadmins: [maria]\n"},
+			env: map[string]string{
+				"ALLOWED_CHATS": " -100, ,-200",
+				"ADMIN_USERS":   "@anna, ivan",
+				"DEBUG":         "true",
+			},
+			want: func(c *config) {
+				c.AllowedChats = []int64{-100, -200}
+				c.Admins = []string{"anna", "ivan"}
+				c.Debug = true
+			},
+		},
+		{
+			name:  "flags over environment",
+			files: map[string]string{"config.yaml": "workers: 2\nqueue_size: 4\n"},
+			env:   map[string]string{"LOG_LEVEL": "debug", "DATABASE_URL": "sqlite://env.db", "DEBUG": "true"},
+			args:  []string{"-log-level", "warn", "-database", "sqlite://flag.db", "-debug=false", "-queue-size", "16"},
+			want: func(c *config) {
+				c.LogLevel = "warn"
+				c.Database = "sqlite://flag.db"
+				c.Workers = 2
+				c.QueueSize = 16
+			},
+		},
+		{
+			name:  "flag equal to its default",
+			files: map[string]string{"config.yaml": "workers: 2\nshutdown_timeout: 5s\n"},
+			args:  []string{"-workers", "8"},
+			want:  func(c *config) { c.ShutdownTimeout = 5 * time.Second },
+		},
+		{
+			name: "-memory over -database",
+			env:  map[string]string{"DATABASE_URL": "sqlite://env.db"},
+			args: []string{"-database", "sqlite://flag.db", "-memory"},
+			want: func(c *config) { c.Database = storage.MemoryURL },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := runSetupConfig(t, test.files, test.env, test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := defaultConfig()
+			test.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		args  []string
+		want  string
+	}{
+		{name: "unknown field", files: map[string]string{"config.yaml": "curency: EUR\n"}, want: "field curency not found"},
+		{name: "wrong type", files: map[string]string{"config.yaml": "workers: many\n"}, want: "config.yaml"},
+		{name: "missing -config", args: []string{"-config", "missing.yaml"}, want: "missing.yaml"},
+		{name: "DEBUG", env: map[string]string{"DEBUG": "maybe"}, want: "DEBUG"},
+		{name: "DIGEST_HOUR", files: map[string]string{".env": "DIGEST_HOUR=noon\n"}, want: "DIGEST_HOUR"},
+		{name: "ALLOWED_CHATS", env: map[string]string{"ALLOWED_CHATS": "-100,kitchen"}, want: `"kitchen" is not a chat ID`},
+		{name: "log level", env: map[string]string{"LOG_LEVEL": "loud"}, want: `unknown log level "loud"`},
+		{name: "currency", files: map[string]string{"config.yaml": "currency: GBP\n"}, want: `unsupported currency "GBP"`},
+		{name: "locale", env: map[string]string{"LOCALE": "de"}, want: `unsupported locale "de"`},
+		{name: "digest hour", files: map[string]string{"config.yaml": "digest_hour: 24\n"}, want: "digest_hour"},
+		{name: "database", env: map[string]string{"DATABASE_URL": ""}, want: "database is not set"},
+		{name: "workers", args: []string{"-workers", "0"}, want: "workers and queue_size"},
+		{name: "queue size", files: map[string]string{"config.yaml": "queue_size: -1\n"}, want: "workers and queue_size"},
+		{name: "shutdown timeout", args: []string{"-shutdown-timeout", "0s"}, want: "shutdown_timeout"},
+		{name: "allowed chat 0", files: map[string]string{"config.yaml": "allowed_chats: [0]\n"}, want: "allowed_chats contains 0"},
+		{name: "cert without key", env: map[string]string{"WEBHOOK_CERT": "cert.pem"}, want: "cert_file and key_file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := runSetupConfig(t, test.files, test.env, test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got %v, want an error containing %q", err, test.want)
+			}
+			if !reflect.DeepEqual(got, defaultConfig()) {
+				t.Errorf("an invalid configuration was put in effect: %+v", got)
+			}
+		})
+	}
+}
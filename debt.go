@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+)
+
+// debtMessage is a message that records a debt: "@all amount [reason]" or
+// "@user1 [@user2 ...] amount [reason]", where the reason may end with a due
+// date, "до 2026-11-01"
+type debtMessage struct {
+	All     bool     // split between all members of the chat
+	Debtors []string // usernames the amount is split between otherwise
+	Amount  int
+	Reason  string
+	Due     time.Time // zero if none
+}
+
+// dueDateRe matches a due date at the end of a reason
+var dueDateRe = regexp.MustCompile(`(?:^|\s+)(?:до|by)\s+(\d{4}-\d{2}-\d{2})\s*$`)
+
+// splitDueDate separates the due date from the end of a reason. The date is
+// returned at midnight UTC, like the calendar days of dateOf; a reason
+// without a valid date is returned unchanged with a zero date.
+func splitDueDate(reason string) (string, time.Time) {
+	match := dueDateRe.FindStringSubmatchIndex(reason)
+	if match == nil {
+		return reason, time.Time{}
+	}
+	due, err := time.Parse("2006-01-02", reason[match[2]:match[3]])
+	if err != nil {
+		return reason, time.Time{}
+	}
+	return reason[:match[0]], due
+}
+
+// dueDatePassed reports whether a due date is before today in a chat's
+// timezone. Debts cannot be recorded as overdue already.
+func dueDatePassed(chatID int64, due time.Time) bool {
+	return !due.IsZero() && due.Before(dateOf(clock().In(getChatLocation(chatID))))
+}
+
+// parseDebtMessage parses a debt message, reporting whether text is one
+func parseDebtMessage(text string) (debtMessage, bool) {
+	// First, check if it's an @all command
+	allRe := regexp.MustCompile(`@all\s+(\d+(?:\.\d+)?)(?:\s+(.+))?`)
+	if allMatches := allRe.FindStringSubmatch(text); allMatches != nil {
+		debt := debtMessage{All: true, Amount: parseMoney(allMatches[1])}
+		debt.Reason, debt.Due = splitDueDate(allMatches[2])
+		return debt, true
+	}
+
+	// Handle multiple users
+	multiRe := regexp.MustCompile(`((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?`)
+	multiMatches := multiRe.FindStringSubmatch(text)
+	if multiMatches == nil {
+		return debtMessage{}, false
+	}
+	usernames := regexp.MustCompile(`@(\w+)`).FindAllStringSubmatch(multiMatches[1], -1)
+	if len(usernames) == 0 {
+		return debtMessage{}, false
+	}
+	debt := debtMessage{Amount: parseMoney(multiMatches[2])}
+	debt.Reason, debt.Due = splitDueDate(multiMatches[3])
+	for _, username := range usernames {
+		debt.Debtors = append(debt.Debtors, username[1])
+	}
+	return debt, true
+}
+
+// recordDebtMessage records a debt message sent by from at the given time,
+// notifies the debtors and returns the reply for the chat
+func recordDebtMessage(bot telegramClient, chat *tgbotapi.Chat, from string, debt debtMessage, at time.Time, lang i18n.Lang) string {
+	debtors := debt.Debtors
+	if debt.All {
+		// Get all chat administrators
+		admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+			ChatConfig: tgbotapi.ChatConfig{
+				ChatID: chat.ID,
+			},
+		})
+		if err != nil {
+			return lang.T("error.members")
+		}
+
+		// Split between active members (excluding bots)
+		debtors = nil
+		for _, admin := range admins {
+			if !admin.User.IsBot {
+				debtors = append(debtors, admin.User.UserName)
+			}
+		}
+		if len(debtors) <= 1 {
+			return lang.T("all.too_few")
+		}
+	}
+
+	// Split amount between users
+	splitAmount := debt.Amount / len(debtors)
+	recorded, err := chatLedger.RecordSplit(ledger.Split{
+		ChatID:  chat.ID,
+		Payer:   from,
+		Debtors: debtors,
+		Share:   splitAmount,
+		Reason:  debt.Reason,
+		Time:    at,
+		Due:     debt.Due,
+	})
+	if err != nil {
+		log.Printf("Error saving operation: %v", err)
+		return lang.T("error.operation")
+	}
+
+	var response strings.Builder
+	if debt.All {
+		response.WriteString(lang.N("all.done", len(debtors), formatAmount(lang, debt.Amount), len(debtors), formatAmount(lang, splitAmount)) + "\n")
+	} else {
+		response.WriteString(lang.N("split.done", len(debtors), formatAmount(lang, debt.Amount), len(debtors), formatAmount(lang, splitAmount)) + "\n")
+	}
+	writeRecorded(&response, lang, from, recorded)
+	notifyRecorded(bot, chat, from, recorded, debt.Reason)
+	return response.String()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dispatcher handles updates on a fixed pool of workers. All updates of a
+// chat go to the same worker, so chats are served in parallel while the
+// operations of each chat stay in order. Scheduled jobs of a chat are queued
+// on the same worker. Every worker has a bounded queue; when it is full
+// dispatch blocks, which stops reading further updates.
+type dispatcher struct {
+	queues []chan task
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[int]bool // IDs of queued and running updates
+	next    int          // ID after the last dispatched update
+
+	handled chan struct{} // receives a value after updates are handled
+}
+
+// task is an update to handle or a scheduled job to run on a worker
+type task struct {
+	update tgbotapi.Update
+	job    func() // run instead of handling update if set
+}
+
+// newDispatcher starts workers that pass updates to handle
+func newDispatcher(workers, queueSize int, handle func(tgbotapi.Update)) *dispatcher {
+	d := &dispatcher{
+		queues:  make([]chan task, workers),
+		pending: make(map[int]bool),
+		handled: make(chan struct{}, 1),
+	}
+	for i := range d.queues {
+		queue := make(chan task, queueSize)
+		d.queues[i] = queue
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for task := range queue {
+				if task.job != nil {
+					task.job()
+					continue
+				}
+				handle(task.update)
+				d.mu.Lock()
+				delete(d.pending, task.update.UpdateID)
+				d.mu.Unlock()
+				select {
+				case d.handled <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	return d
+}
+
+// dispatch queues an update on the worker of its chat, waiting while that
+// worker's queue is full
+func (d *dispatcher) dispatch(update tgbotapi.Update) {
+	d.mu.Lock()
+	d.pending[update.UpdateID] = true
+	if update.UpdateID >= d.next {
+		d.next = update.UpdateID + 1
+	}
+	d.mu.Unlock()
+
+	d.queue(updateChatID(update), task{update: update})
+}
+
+// run queues a scheduled job of a chat on the chat's worker, so that it does
+// not race the chat's updates. It must not be called after close.
+func (d *dispatcher) run(chatID int64, job func()) {
+	d.queue(chatID, task{job: job})
+}
+
+// queue queues a task on the worker of a chat, waiting while its queue is full
+func (d *dispatcher) queue(chatID int64, task task) {
+	worker := int(uint64(chatID) % uint64(len(d.queues)))
+	select {
+	case d.queues[worker] <- task:
+	default:
+		logf(levelWarn, "Queue of worker %d is full, waiting", worker)
+		d.queues[worker] <- task
+	}
+}
+
+// close stops accepting updates and waits until the queued ones are handled
+func (d *dispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+// closeWithin is close giving up after timeout. It reports whether every
+// queued update was handled.
+func (d *dispatcher) closeWithin(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// offset returns the ID of the first update that has not been handled yet:
+// every update before it is done, so Telegram may forget them.
+func (d *dispatcher) offset() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	offset := d.next
+	for id := range d.pending {
+		if id < offset {
+			offset = id
+		}
+	}
+	return offset
+}
+
+// progress returns a channel that receives a value after updates are handled,
+// when offset may have moved. Only one goroutine should wait on it.
+func (d *dispatcher) progress() <-chan struct{} {
+	return d.handled
+}
+
+// updateChatID returns the chat an update belongs to, or 0 if there is none
+func updateChatID(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	return 0
+}
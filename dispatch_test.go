@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatUpdate returns a message update in a chat
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := make(map[int64][]int)
+	d := newDispatcher(3, 4, func(update tgbotapi.Update) {
+		// Later updates of a chat would overtake slow earlier ones if they could
+		time.Sleep(time.Duration(update.UpdateID%3) * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := updateChatID(update)
+		handled[chatID] = append(handled[chatID], update.UpdateID)
+	})
+
+	chats := []int64{-100, -200, -300, 7}
+	for id := 1; id <= 40; id++ {
+		d.dispatch(chatUpdate(id, chats[id%len(chats)]))
+	}
+	d.close()
+
+	for _, chatID := range chats {
+		ids := handled[chatID]
+		if len(ids) != 10 {
+			t.Errorf("chat %d: handled %v, want 10 updates", chatID, ids)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("chat %d: handled %v out of order", chatID, ids)
+				break
+			}
+		}
+	}
+	if offset := d.offset(); offset != 41 {
+		t.Errorf("offset after close = %d, want 41", offset)
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	fast := make(chan int, 1)
+	// Chats 2 and 3 go to different workers of two
+	d := newDispatcher(2, 1, func(update tgbotapi.Update) {
+		if updateChatID(update) == 2 {
+			<-release
+			return
+		}
+		fast <- update.UpdateID
+	})
+	defer d.close()
+	defer close(release)
+
+	d.dispatch(chatUpdate(1, 2))
+	d.dispatch(chatUpdate(2, 3))
+	select {
+	case id := <-fast:
+		if id != 2 {
+			t.Errorf("handled update %d, want 2", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat blocked another chat")
+	}
+	if offset := d.offset(); offset != 1 {
+		t.Errorf("offset while update 1 runs = %d, want 1", offset)
+	}
+}
+
+func TestDispatcherFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []int
+	d := newDispatcher(1, 1, func(update tgbotapi.Update) {
+		if update.UpdateID == 1 {
+			<-release
+		}
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		mu.Unlock()
+	})
+
+	// Update 1 runs and update 2 fills the queue, so update 3 has to wait
+	d.dispatch(chatUpdate(1, -100))
+	d.dispatch(chatUpdate(2, -100))
+	dispatched := make(chan struct{})
+	go func() {
+		d.dispatch(chatUpdate(3, -100))
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("dispatch returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if offset := d.offset(); offset != 1 {
+		t.Errorf("offset with a full queue = %d, want 1", offset)
+	}
+
+	close(release)
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch still blocked after the queue drained")
+	}
+	d.close()
+	if want := []int{1, 2, 3}; len(handled) != len(want) || handled[0] != 1 || handled[1] != 2 || handled[2] != 3 {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+	if offset := d.offset(); offset != 4 {
+		t.Errorf("offset after close = %d, want 4", offset)
+	}
+}
+
+func TestDispatcherRunsJobsInChatOrder(t *testing.T) {
+	var order []string
+	d := newDispatcher(2, 4, func(update tgbotapi.Update) {
+		order = append(order, "update")
+	})
+	d.dispatch(chatUpdate(1, -100))
+	d.run(-100, func() { order = append(order, "job") })
+	d.dispatch(chatUpdate(2, -100))
+	if !d.closeWithin(time.Second) {
+		t.Fatal("closeWithin timed out")
+	}
+	if got := len(order); got != 3 || order[0] != "update" || order[1] != "job" || order[2] != "update" {
+		t.Errorf("ran %v, want the job between the updates", order)
+	}
+}
+
+func TestDispatcherCloseWithinTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	d := newDispatcher(1, 1, func(tgbotapi.Update) { <-release })
+	d.dispatch(chatUpdate(1, -100))
+	if d.closeWithin(20 * time.Millisecond) {
+		t.Error("closeWithin reported a stuck update as handled")
+	}
+	if offset := d.offset(); offset != 1 {
+		t.Errorf("offset after timing out = %d, want the stuck update", offset)
+	}
+}
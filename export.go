@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportHeader is the column layout of CSV exports. /import recognises it as
+// well as the layout of exports made before the due column was added.
+var exportHeader = []string{"operation_id", "time", "creditor", "debtor", "amount", "type", "reason", "due"}
+
+// formulaPrefixes start cells that spreadsheets evaluate as formulas
+const formulaPrefixes = "=+-@\t\r"
+
+// LedgerEntry is a single row of a chat's ledger as it appears in exports
+type LedgerEntry struct {
+	OperationID int         `json:"operation_id"`
+	Time        time.Time   `json:"time"`
+	Creditor    string      `json:"creditor"`
+	Debtor      string      `json:"debtor"`
+	Amount      json.Number `json:"amount"`
+	Type        string      `json:"type"`
+	Reason      string      `json:"reason"`
+	Due         string      `json:"due,omitempty"` // YYYY-MM-DD, empty if none
+}
+
+// getLedgerEntries returns every row of a chat in chronological order with
+// times in loc. If since is not zero only rows from that time on are returned.
+func getLedgerEntries(chatID int64, since time.Time, loc *time.Location) ([]LedgerEntry, error) {
+	rows, err := store.Entries(chatID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LedgerEntry
+	for _, row := range rows {
+		entries = append(entries, LedgerEntry{
+			OperationID: row.OperationID,
+			Time:        row.Time.In(loc),
+			Creditor:    row.From,
+			Debtor:      row.To,
+			Amount:      json.Number(formatMoney(row.Amount)),
+			Type:        row.Type,
+			Reason:      row.Reason,
+			Due:         formatDueDate(row.Due),
+		})
+	}
+	return entries, nil
+}
+
+// formatDueDate formats a due date for exports, or returns "" if there is none
+func formatDueDate(due time.Time) string {
+	if due.IsZero() {
+		return ""
+	}
+	return due.Format("2006-01-02")
+}
+
+// escapeCSVCell keeps a spreadsheet from running a cell as a formula by
+// prefixing it with an apostrophe. Cells that start with one are prefixed
+// too, so that unescapeCSVCell restores every cell exactly.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune(formulaPrefixes+"'", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCSVCell reverses escapeCSVCell
+func unescapeCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes+"'", rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// exportCSV encodes ledger entries as CSV with a header row. Names and
+// reasons are escaped against formula injection.
+func exportCSV(entries []LedgerEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(exportHeader); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		record := []string{
+			strconv.Itoa(entry.OperationID),
+			entry.Time.Format(time.RFC3339),
+			escapeCSVCell(entry.Creditor),
+			escapeCSVCell(entry.Debtor),
+			entry.Amount.String(),
+			entry.Type,
+			escapeCSVCell(entry.Reason),
+			entry.Due,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// exportJSON encodes ledger entries as an indented JSON array
+func exportJSON(entries []LedgerEntry) ([]byte, error) {
+	if entries == nil {
+		entries = []LedgerEntry{}
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/storage"
+)
+
+// genderNames maps the arguments of /gender to genders
+var genderNames = map[string]storage.Gender{
+	"m": storage.GenderMale,
+	"f": storage.GenderFemale,
+	"n": storage.GenderNeutral,
+	"м": storage.GenderMale,
+	"ж": storage.GenderFemale,
+	"н": storage.GenderNeutral,
+}
+
+// getUserGender returns the gender a user is addressed in. Users who have not
+// chosen one are addressed in the masculine, as before /gender existed.
+func getUserGender(username string) storage.Gender {
+	gender, err := store.UserGender(username)
+	if err != nil {
+		log.Printf("Error getting user gender: %v", err)
+		return storage.GenderMale
+	}
+	if gender == storage.GenderUnset {
+		return storage.GenderMale
+	}
+	return gender
+}
+
+// importLegacyWomen addresses the users listed in the deprecated women
+// setting in the feminine, unless they have chosen a gender with /gender
+func importLegacyWomen() error {
+	for _, name := range cfg.Women {
+		gender, err := store.UserGender(name)
+		if err != nil {
+			return err
+		}
+		if gender != storage.GenderUnset {
+			continue
+		}
+		if err := store.SetUserGender(name, storage.GenderFemale); err != nil {
+			return err
+		}
+		log.Printf("Addressing %s in the feminine as listed in women, which is deprecated", name)
+	}
+	return nil
+}
+
+// describeGender names a gender in a /gender reply
+func describeGender(lang i18n.Lang, gender storage.Gender) string {
+	return lang.G("gender.name", i18n.Gender(gender))
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// historyPageSize is the most rows shown on a single /history page. Pages of
+// long rows hold fewer, so that every page fits into a message.
+const historyPageSize = 15
+
+// historyCallbackPrefix starts the callback data of /history navigation
+// buttons, which is followed by the page and the encoded filter
+const historyCallbackPrefix = "history:"
+
+// maxCallbackData is the longest callback data Telegram accepts, in bytes
+const maxCallbackData = 64
+
+// historyFilter narrows down the rows shown by /history. Days and dates are
+// calendar days in the time zone of the chat.
+type historyFilter struct {
+	Days int
+	User string
+	Tag  string
+	From time.Time
+	To   time.Time
+	Type string
+}
+
+var errInvalidHistoryFilter = errors.New("invalid history filter")
+
+// parseHistoryFilter parses the arguments of /history. Without any filter
+// only the last day is shown, as before filters existed.
+func parseHistoryFilter(args string) (historyFilter, error) {
+	var filter historyFilter
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case strings.HasPrefix(field, "@") && len(field) > 1:
+			filter.User = field[1:]
+		case strings.HasPrefix(field, "#") && len(field) > 1:
+			filter.Tag = ledger.NormalizeTag(field[1:])
+		case strings.HasPrefix(field, "type:"):
+			filter.Type = strings.TrimPrefix(field, "type:")
+			if filter.Type != "debt" && filter.Type != "return" {
+				return filter, errInvalidHistoryFilter
+			}
+		case field == "from" || field == "to":
+			if i+1 == len(fields) {
+				return filter, errInvalidHistoryFilter
+			}
+			i++
+			date, err := time.Parse("2006-01-02", fields[i])
+			if err != nil {
+				return filter, errInvalidHistoryFilter
+			}
+			if field == "from" {
+				filter.From = date
+			} else {
+				filter.To = date
+			}
+		default:
+			days, err := strconv.Atoi(field)
+			if err != nil || days <= 0 {
+				return filter, errInvalidHistoryFilter
+			}
+			filter.Days = days
+		}
+	}
+
+	if filter.Days == 0 && filter.From.IsZero() && filter.To.IsZero() && filter.User == "" && filter.Tag == "" && filter.Type == "" {
+		filter.Days = 1 // Default to 1 day if no filter provided
+	}
+	return filter, nil
+}
+
+// describe returns a human readable summary of the filter for the history header
+func (f historyFilter) describe(lang i18n.Lang) string {
+	var parts []string
+	if f.Days > 0 {
+		parts = append(parts, describePeriod(lang, f.Days))
+	}
+	if !f.From.IsZero() {
+		parts = append(parts, lang.T("history.from", f.From.Format("02.01.2006")))
+	}
+	if !f.To.IsZero() {
+		parts = append(parts, lang.T("history.to", f.To.Format("02.01.2006")))
+	}
+	if f.User != "" {
+		parts = append(parts, lang.T("history.user", f.User))
+	}
+	if f.Tag != "" {
+		parts = append(parts, lang.T("history.tag", f.Tag))
+	}
+	switch f.Type {
+	case "debt":
+		parts = append(parts, lang.T("history.debts"))
+	case "return":
+		parts = append(parts, lang.T("history.returns"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// storageFilter converts the filter into the store's terms, resolving
+// calendar days in the given zone
+func (f historyFilter) storageFilter(loc *time.Location) storage.HistoryFilter {
+	filter := storage.HistoryFilter{User: f.User, Tag: f.Tag, Type: f.Type}
+	if f.Days > 0 {
+		filter.Since = periodStart(loc, f.Days)
+	}
+	if !f.From.IsZero() {
+		from := time.Date(f.From.Year(), f.From.Month(), f.From.Day(), 0, 0, 0, 0, loc)
+		if from.After(filter.Since) {
+			filter.Since = from
+		}
+	}
+	if !f.To.IsZero() {
+		filter.Until = time.Date(f.To.Year(), f.To.Month(), f.To.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return filter
+}
+
+// encode packs the filter into callback data as fields separated by "|",
+// which neither usernames nor tags contain
+func (f historyFilter) encode() string {
+	fields := make([]string, 6)
+	if f.Days > 0 {
+		fields[0] = strconv.Itoa(f.Days)
+	}
+	fields[1] = f.User
+	fields[2] = f.Tag
+	if !f.From.IsZero() {
+		fields[3] = f.From.Format("20060102")
+	}
+	if !f.To.IsZero() {
+		fields[4] = f.To.Format("20060102")
+	}
+	fields[5] = f.Type
+	return strings.Join(fields, "|")
+}
+
+// decodeHistoryFilter unpacks a filter packed by encode
+func decodeHistoryFilter(data string) (historyFilter, error) {
+	fields := strings.Split(data, "|")
+	if len(fields) != 6 {
+		return historyFilter{}, errInvalidHistoryFilter
+	}
+	filter := historyFilter{User: fields[1], Tag: fields[2], Type: fields[5]}
+	var err error
+	if fields[0] != "" {
+		if filter.Days, err = strconv.Atoi(fields[0]); err != nil || filter.Days <= 0 {
+			return historyFilter{}, errInvalidHistoryFilter
+		}
+	}
+	if fields[3] != "" {
+		if filter.From, err = time.Parse("20060102", fields[3]); err != nil {
+			return historyFilter{}, errInvalidHistoryFilter
+		}
+	}
+	if fields[4] != "" {
+		if filter.To, err = time.Parse("20060102", fields[4]); err != nil {
+			return historyFilter{}, errInvalidHistoryFilter
+		}
+	}
+	if filter.Type != "" && filter.Type != "debt" && filter.Type != "return" {
+		return historyFilter{}, errInvalidHistoryFilter
+	}
+	return filter, nil
+}
+
+// historyCallbackData returns the callback data of a button opening a page
+func historyCallbackData(filter historyFilter, page int) string {
+	return historyCallbackPrefix + strconv.Itoa(page) + ":" + filter.encode()
+}
+
+// paginateHistory splits rows into pages of at most historyPageSize rows and
+// size bytes. A row longer than size is cut to fit.
+func paginateHistory(rows []string, size int) [][]string {
+	var pages [][]string
+	var page []string
+	length := 0
+	for _, row := range rows {
+		if len(row) > size {
+			row = truncateText(row, size)
+		}
+		if len(page) == historyPageSize || length+len(row) > size {
+			pages = append(pages, page)
+			page, length = nil, 0
+		}
+		page = append(page, row)
+		length += len(row)
+	}
+	return append(pages, page)
+}
+
+// truncateText cuts text to at most size bytes on a rune boundary, marking the cut with "…"
+func truncateText(text string, size int) string {
+	const ellipsis = "…\n"
+	cut := size - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + ellipsis
+}
+
+// renderHistoryPage builds the text and navigation buttons of a /history page.
+// The markup is nil when everything fits on a single page.
+func renderHistoryPage(chatID int64, filter historyFilter, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	lang := getChatLang(chatID)
+	loc := getChatLocation(chatID)
+	storageFilter := filter.storageFilter(loc)
+	history, err := chatLedger.History(chatID, storageFilter, loc, 0, historyPageSize)
+	if err == nil && history.Total > len(history.Entries) {
+		// Pages are cut by length, so every row up to the page is needed
+		history, err = chatLedger.History(chatID, storageFilter, loc, 0, history.Total)
+	}
+	if err != nil {
+		log.Printf("Error getting history page: %v", err)
+		return lang.T("error.history"), nil
+	}
+	if history.Total == 0 {
+		return lang.T("history.empty", filter.describe(lang)), nil
+	}
+
+	rows := make([]string, len(history.Entries))
+	for i, entry := range history.Entries {
+		rows[i] = fmt.Sprintf("[%s] %s\n", entry.Time.Format("02.01.2006 15:04"), describeEntry(lang, entry))
+	}
+	title := lang.T("history.title", filter.describe(lang))
+	// There are never more pages than rows
+	header := len(title) + len(lang.T("history.page", len(rows), len(rows))) + len(":\n\n")
+	pages := paginateHistory(rows, maxMessageLength-header)
+	page = max(0, min(page, len(pages)-1))
+
+	var response strings.Builder
+	response.WriteString(title)
+	if len(pages) > 1 {
+		response.WriteString(lang.T("history.page", page+1, len(pages)))
+	}
+	response.WriteString(":\n\n")
+	for _, row := range pages[page] {
+		response.WriteString(row)
+	}
+
+	if len(pages) == 1 {
+		return response.String(), nil
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("◀", historyCallbackData(filter, page-1)))
+	}
+	if page < len(pages)-1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("▶", historyCallbackData(filter, page+1)))
+	}
+	for _, button := range buttons {
+		if len(*button.CallbackData) > maxCallbackData {
+			// Telegram would reject the buttons and the page with them
+			return response.String() + "\n" + lang.T("history.no_buttons"), nil
+		}
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	return response.String(), &markup
+}
+
+// handleHistoryCallback turns the page of a /history message when a navigation
+// button is pressed. The button carries the page and the filter, so no state
+// has to be kept between presses.
+func handleHistoryCallback(bot telegramClient, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	pageData, filterData, _ := strings.Cut(strings.TrimPrefix(query.Data, historyCallbackPrefix), ":")
+	page, err := strconv.Atoi(pageData)
+	if err != nil || page < 0 {
+		bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	filter, err := decodeHistoryFilter(filterData)
+	if err != nil {
+		// Buttons sent before the filter was part of the data
+		bot.Request(tgbotapi.NewCallbackWithAlert(query.ID, getChatLang(query.Message.Chat.ID).T("history.expired")))
+		return
+	}
+	bot.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	text, markup := renderHistoryPage(query.Message.Chat.ID, filter, page)
+	if markup == nil {
+		bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text))
+		return
+	}
+	bot.Send(tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, text, *markup))
+}
@@ -0,0 +1,248 @@
+package i18n
+
+// en is the English catalog
+var en = map[string]Message{
+	"lang.name": {Other: "English"},
+
+	// Help, see helpSections in the main package
+	"help.title":            {Other: "How to use the bot:"},
+	"help.recording":        {Other: "Recording a debt"},
+	"help.debt":             {Other: "@username amount [reason] - record a debt of one person"},
+	"help.split":            {Other: "@user1 @user2 amount [reason] - split an amount between several people"},
+	"help.all":              {Other: "@all amount [reason] - split an amount between all members of the chat"},
+	"help.each":             {Other: "/each @username1 [@username2 ...] amount [reason] - lend the amount to each of the given users"},
+	"help.due":              {Other: "@username amount [reason] by YYYY-MM-DD - a debt with a due date, overdue ones are marked in /balance and included in reminders"},
+	"help.commands":         {Other: "Commands"},
+	"help.balance":          {Other: "/balance - show all debts in the chat"},
+	"help.balance_me":       {Other: "/balance me - show your own debts"},
+	"help.history":          {Other: "/history [days] - show the operation history (1 day by default)"},
+	"help.history_filters":  {Other: "/history @username, /history #tag, /history type:return - history filters"},
+	"help.history_period":   {Other: "/history from 2026-09-01 to 2026-09-30 - history of a period"},
+	"help.cancel":           {Other: "/cancel - cancel the latest operation"},
+	"help.remind":           {Other: "/remind on [daily|weekly] [days] [dm] - regularly remind of debts older than so many days (weekly of debts older than 7 days by default), with dm privately to every debtor"},
+	"help.remind_off":       {Other: "/remind off - turn reminders off"},
+	"help.nudge":            {Other: "/nudge @username - politely remind someone of what they owe you"},
+	"help.recurring":        {Other: "/recurring add daily|weekly 1-7|monthly 1-31 message - record an operation on a schedule, e.g. /recurring add monthly 1 @all 45000 rent"},
+	"help.recurring_manage": {Other: "/recurring list, /recurring pause|resume|delete number - the recurring operations of the chat"},
+	"help.stats":            {Other: "/stats [days] - who paid and consumed how much, largest expenses (30 days by default)"},
+	"help.stats_categories": {Other: "/stats categories [days] - spending by category (30 days by default)"},
+	"help.export":           {Other: "/export csv|json [days] - send every operation of the chat as a file"},
+	"help.timezone":         {Other: "/timezone [zone] - show or set the time zone of the chat, e.g. Europe/Moscow"},
+	"help.gender":           {Other: "/gender m|f|n - how Russian replies address you: должен, должна or neutral (долг перед)"},
+	"help.lang":             {Other: "/lang ru|en - language of the bot in this chat"},
+	"help.import":           {Other: "/import - load operations from CSV (a Splitwise export or /export csv)"},
+	"help.chart_balance":    {Other: "/chart balance - a picture of the members' balances"},
+	"help.chart_spending":   {Other: "/chart spending [days] - a picture of the members' spending (30 days by default)"},
+	"help.mybalance":        {Other: "/mybalance - in a private chat with the bot: your balance in every group"},
+	"help.notify":           {Other: "/notify now|daily|mute - in a private chat with the bot: hear about operations involving you at once, once a day or never"},
+	"help.help":             {Other: "/help - show this message"},
+	"help.categories":       {Other: "Categories"},
+	"help.tags":             {Other: "#tags in the reason are saved and set the category of the operation"},
+	"help.keywords":         {Other: "without tags the category is guessed from the words of the reason"},
+	"help.examples":         {Other: "Examples:"},
+	"help.examples.list":    {Other: "• @ivan 50 lunch\n• @ivan @maria 100 dinner\n• @all 150 party\n• @all 2000 #продукты groceries\n• /history 30 - show the history of 30 days"},
+	"private.only":          {Other: "Debts are recorded in group chats, please add me to a group chat! Here /mybalance shows your balance in every group."},
+	"command.unknown":       {Other: "Unknown command"},
+	"period.days":           {One: "for the last %d day", Other: "for the last %d days"},
+	"period.today":          {Other: "for today"},
+	"error.balance":         {Other: "Error calculating the balance. Please try again."},
+	"error.cancel":          {Other: "Error cancelling the operation. Please try again."},
+	"error.stats":           {Other: "Error getting the statistics. Please try again."},
+	"error.chart":           {Other: "Error drawing the chart. Please try again."},
+	"error.export":          {Other: "Error exporting the operations. Please try again."},
+	"error.timezone":        {Other: "Error saving the time zone. Please try again."},
+	"error.gender":          {Other: "Error saving the gender. Please try again."},
+	"error.lang":            {Other: "Error saving the language. Please try again."},
+	"error.operation":       {Other: "Error processing the operation. Please try again."},
+	"error.members":         {Other: "Error getting the list of members. Please try again."},
+	"error.remind":          {Other: "Error saving the reminder. Please try again."},
+	"error.recurring":       {Other: "Error saving the recurring operation. Please try again."},
+	"error.notify":          {Other: "Error saving the notification settings. Please try again."},
+	"error.history":         {Other: "Error getting the history. Please try again."},
+	"error.download":        {Other: "Error downloading the file. Please try again."},
+
+	// Counted nouns for messages with several counts, see Lang.Count
+	"count.operations": {One: "%d operation", Other: "%d operations"},
+	"count.records":    {One: "%d row", Other: "%d rows"},
+	"count.people":     {One: "%d person", Other: "%d people"},
+	"count.rubles":     {One: "%d ruble", Other: "%d rubles"},
+	"count.kopecks":    {One: "%d kopeck", Other: "%d kopecks"},
+
+	// Ledger entries
+	"owes":              {Other: "%s owes %s %s"},
+	"returned":          {Other: "%s returned to %s %s"},
+	"returned_and_owes": {Other: "%s and now %s"},
+	"due":               {Other: "%s, due by %s"},
+	"overdue":           {Other: "⚠️ %s — overdue, was due by %s"},
+	"recorded.category": {Other: "Category: %s"},
+	"recorded.due":      {Other: "Due by %s"},
+	"due.past":          {Other: "The due date %s has already passed. Give today or a later date, e.g. @username 500 tickets by YYYY-MM-DD"},
+
+	// Recording
+	"each.usage":    {Other: "Usage: /each @username1 [@username2 ...] amount [reason]"},
+	"each.no_users": {Other: "No users given. Usage: /each @username1 [@username2 ...] amount [reason]"},
+	"each.done":     {One: "Added a debt of %s for %d user:", Other: "Added debts of %s for %d users:"},
+	"all.too_few":   {Other: "Not enough members in the chat."},
+	"all.done":      {One: "Split %s between %d member (%s each):", Other: "Split %s between %d members (%s each):"},
+	"split.done":    {One: "Split %s between %d user (%s each):", Other: "Split %s between %d users (%s each):"},
+
+	// /balance
+	"balance.mine":      {Other: "Your debts:"},
+	"balance.mine.none": {Other: "You have no outstanding debts."},
+	"balance.chat":      {Other: "Debts in this chat:"},
+	"balance.none":      {Other: "No outstanding debts."},
+
+	// /mybalance
+	"dashboard.total":    {Other: "Your balance in all chats: %s"},
+	"dashboard.none":     {Other: "You have no outstanding debts in any chat."},
+	"dashboard.untitled": {Other: "Chat %d"},
+	"dashboard.in_group": {Other: "Send /mybalance to me in a private message to see your balance in all chats."},
+
+	// /notify
+	"notify.current":     {Other: "Notifications: %s.\nChange: /notify now|daily|mute"},
+	"notify.set":         {Other: "Notifications: %s."},
+	"notify.usage":       {Other: "Use /notify now for at once, /notify daily for a daily digest, /notify mute for none"},
+	"notify.no_username": {Other: "Set a username in the Telegram settings, operations in groups are recorded by it."},
+	"notify.in_group":    {Other: "Send /notify to me in a private message to be notified about operations involving you."},
+	"notify.mode.now":    {Other: "at once"},
+	"notify.mode.daily":  {Other: "daily digest"},
+	"notify.mode.mute":   {Other: "muted"},
+	"notify.mode.unset":  {Other: "off"},
+	"notify.recorded":    {Other: "%s recorded in “%s”:"},
+	"notify.cancelled":   {Other: "%s cancelled an operation in “%s”:"},
+	"notify.digest":      {Other: "Today's operations involving you:"},
+
+	// /cancel
+	"cancel.nothing":    {Other: "There are no operations to cancel in this chat."},
+	"cancel.not_author": {Other: "You cannot cancel this operation. It was made by %s."},
+	"cancel.gone":       {Other: "The operation was not found or has already been cancelled."},
+	"cancel.done":       {Other: "Cancelled the latest operation (ID: %d):"},
+	"cancel.deleted":    {One: "Deleted %d row", Other: "Deleted %d rows"},
+
+	// /remind, /nudge
+	"remind.usage":      {Other: "Usage: /remind on [daily|weekly] [days] [dm] or /remind off"},
+	"remind.off":        {Other: "Debt reminders are off. Turn them on: /remind on [daily|weekly] [days] [dm]"},
+	"remind.on":         {One: "Reminders: %s of debts older than %d day, %s. Next: %s.", Other: "Reminders: %s of debts older than %d days, %s. Next: %s."},
+	"remind.to_chat":    {Other: "to this chat"},
+	"remind.to_debtors": {Other: "privately to every debtor"},
+	"remind.title":      {One: "Reminder of debts older than %d day and overdue ones:", Other: "Reminder of debts older than %d days and overdue ones:"},
+	"remind.direct":     {Other: "A reminder of your debts in “%s”:"},
+	"remind.since":      {Other: "%s since %s"},
+	"nudge.usage":       {Other: "Usage: /nudge @username to remind someone of what they owe you"},
+	"nudge.text":        {Other: "@%s, a friendly reminder from %s:\n%s"},
+	"nudge.none":        {Other: "%s owes you nothing."},
+	"frequency.daily":   {Other: "daily"},
+	"frequency.weekly":  {Other: "weekly"},
+
+	// /recurring
+	"recurring.usage":       {Other: "Usage:\n/recurring add daily|weekly 1-7|monthly 1-31 @username amount [reason]\n/recurring list\n/recurring pause|resume|delete number\nFor example: /recurring add monthly 1 @all 45000 rent"},
+	"recurring.day":         {Other: "Give a day from 1 to %d: 1 is Monday for weekly, the day of the month for monthly."},
+	"recurring.due":         {Other: "A recurring operation cannot have a due date: it would pass while the operation keeps recording debts. Remove \"by YYYY-MM-DD\" from the message."},
+	"recurring.added":       {Other: "Recurring operation #%d: %s “%s”. First recorded on %s."},
+	"recurring.none":        {Other: "This chat has no recurring operations."},
+	"recurring.list":        {Other: "Recurring operations:"},
+	"recurring.item":        {Other: "#%d %s: %s (%s), next on %s"},
+	"recurring.item.paused": {Other: "#%d %s: %s (%s), paused"},
+	"recurring.not_found":   {Other: "Recurring operation #%d not found."},
+	"recurring.not_author":  {Other: "You cannot change this recurring operation. It was added by %s."},
+	"recurring.paused":      {Other: "Recurring operation #%d is paused."},
+	"recurring.resumed":     {Other: "Recurring operation #%d is running again."},
+	"recurring.deleted":     {Other: "Recurring operation #%d deleted."},
+	"recurring.ran":         {Other: "Recurring operation #%d “%s” for %s:"},
+	"schedule.monthly":      {Other: "monthly on day %d"},
+	"schedule.weekly.1":     {Other: "on Mondays"},
+	"schedule.weekly.2":     {Other: "on Tuesdays"},
+	"schedule.weekly.3":     {Other: "on Wednesdays"},
+	"schedule.weekly.4":     {Other: "on Thursdays"},
+	"schedule.weekly.5":     {Other: "on Fridays"},
+	"schedule.weekly.6":     {Other: "on Saturdays"},
+	"schedule.weekly.7":     {Other: "on Sundays"},
+
+	// /history
+	"history.usage":      {Other: "Usage: /history [days] [@username] [#tag] [from YYYY-MM-DD] [to YYYY-MM-DD] [type:debt|return]"},
+	"history.from":       {Other: "from %s"},
+	"history.to":         {Other: "to %s"},
+	"history.user":       {Other: "involving %s"},
+	"history.tag":        {Other: "tagged #%s"},
+	"history.debts":      {Other: "debts only"},
+	"history.returns":    {Other: "returns only"},
+	"history.empty":      {Other: "No operations %s."},
+	"history.title":      {Other: "Operation history %s"},
+	"history.page":       {Other: " (page %d of %d)"},
+	"history.no_buttons": {Other: "Pages cannot be turned with a filter this long. Shorten it or give a period."},
+	"history.expired":    {Other: "These buttons are out of date. Send /history again."},
+
+	// /stats
+	"stats.usage":      {Other: "Usage: /stats [days] or /stats categories [days]"},
+	"stats.empty":      {Other: "No operations %s."},
+	"stats.categories": {Other: "Spending by category %s:"},
+	"stats.category":   {Other: "• %s: %s (%s)"},
+	"stats.total":      {Other: "Total: %s"},
+	"stats.title":      {Other: "Statistics %s:"},
+	"stats.members":    {Other: "Members (paid / consumed / net):"},
+	"stats.member":     {Other: "%d. %s: %s / %s / %s"},
+	"stats.largest":    {Other: "Largest expenses:"},
+	"stats.busiest":    {Other: "Busiest days:"},
+	"stats.day":        {Other: "• %s: %s, %s"},
+
+	// /chart
+	"chart.usage":    {Other: "Usage: /chart balance or /chart spending [days]"},
+	"chart.no_debts": {Other: "There are no outstanding debts in this chat."},
+	"chart.balance":  {Other: "Balance"},
+	"chart.spending": {Other: "Spending %s"},
+	"chart.owed":     {Other: "owed to them"},
+	"chart.owes":     {Other: "they owe"},
+	"chart.paid":     {Other: "paid"},
+	"chart.consumed": {Other: "consumed"},
+
+	// /export
+	"export.usage":   {Other: "Usage: /export csv|json [days]"},
+	"export.empty":   {Other: "There are no operations to export in this chat."},
+	"export.caption": {One: "Exported %d row", Other: "Exported %d rows"},
+
+	// /timezone
+	"timezone.current": {Other: "Time zone of the chat: %s\nChange it: /timezone Europe/Moscow"},
+	"timezone.unknown": {Other: "Unknown time zone. Example: /timezone Europe/Moscow"},
+	"timezone.set":     {Other: "Time zone of the chat: %s. It is %s now."},
+
+	// /gender
+	"gender.no_username": {Other: "To choose a gender, set a username in the Telegram settings."},
+	"gender.current":     {Other: "Gender of %s: %s\nChange it: /gender m, /gender f or /gender n"},
+	"gender.usage":       {Other: "Usage: /gender m (должен), /gender f (должна) or /gender n (neutral)"},
+	"gender.set":         {Other: "Gender of %s: %s"},
+	"gender.name":        {Other: "masculine (должен, вернул)", Feminine: "feminine (должна, вернула)", Neutral: "neutral (долг перед, возврат)"},
+
+	// /lang
+	"lang.current": {Other: "Language of the chat: %s\nChange it: /lang ru or /lang en"},
+	"lang.usage":   {Other: "Usage: /lang ru or /lang en"},
+	"lang.set":     {Other: "Language of the chat: %s"},
+
+	// /import
+	"import.busy":              {Other: "Another user is already importing in this chat."},
+	"import.send_file":         {Other: "Send a CSV file: a Splitwise export or a file from /export csv."},
+	"import.nothing_to_cancel": {Other: "There is no import to cancel."},
+	"import.cancelled":         {Other: "Import cancelled."},
+	"import.not_ready":         {Other: "There is no import ready to be recorded."},
+	"import.failed":            {Other: "Error importing, nothing was recorded. Please try again."},
+	"import.done":              {Other: "Import finished. Recorded %s (%s)."},
+	"import.duplicates":        {Other: "Already in the chat and skipped: %s."},
+	"import.usage":             {Other: "Usage: /import, then /import confirm or /import cancel"},
+	"import.too_big":           {Other: "The file is too big to import."},
+	"import.parse_failed":      {Other: "Could not read the file: %s"},
+	"import.empty":             {Other: "The file has no operations to import."},
+	"import.found":             {Other: "Found %s, %s."},
+	"import.ask":               {Other: "Who is “%s” in this chat? Answer @username or “-” to skip their operations."},
+	"import.members":           {Other: "Members: %s"},
+	"import.mapping":           {Other: "People mapping:"},
+	"import.skip":              {Other: "skip"},
+	"import.summary":           {Other: "To be recorded: %s (%s), total %s."},
+	"import.confirm":           {Other: "Send /import confirm to record them or /import cancel to cancel."},
+	"import.error.empty":       {Other: "the file is empty"},
+	"import.error.format":      {Other: "unknown format, expected a Splitwise export or /export csv"},
+	"import.error.fields":      {One: "line %d: expected %d field", Other: "line %d: expected %d fields"},
+	"import.error.time":        {Other: "line %d: invalid time %q"},
+	"import.error.date":        {Other: "line %d: invalid date %q"},
+	"import.error.amount":      {Other: "line %d: invalid amount %q"},
+	"import.error.type":        {Other: "line %d: unknown operation type %q"},
+	"import.error.currency":    {Other: "line %d: currency %s, but the ledger is kept in %s"},
+}
@@ -0,0 +1,177 @@
+// Package i18n holds the message catalogs of the bot's replies. A message is
+// looked up by key in the catalog of a language and may have plural forms,
+// chosen by a count, or gender variants, chosen by the gender of the person
+// the sentence is about.
+package i18n
+
+import "fmt"
+
+// Lang is a language the bot can answer in, named by its ISO 639-1 code
+type Lang string
+
+const (
+	Russian Lang = "ru"
+	English Lang = "en"
+)
+
+// Langs lists the supported languages
+var Langs = []Lang{Russian, English}
+
+// Parse returns the language with the given code
+func Parse(code string) (Lang, bool) {
+	for _, lang := range Langs {
+		if string(lang) == code {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// Gender selects a gender variant of a message. Its values match the genders
+// users choose with /gender.
+type Gender string
+
+const (
+	Masculine Gender = "m"
+	Feminine  Gender = "f"
+	Neutral   Gender = "n"
+)
+
+// Message is a translation. Other is the text of a plain message, the
+// masculine variant and the plural form used when no other form applies.
+type Message struct {
+	Other string
+
+	// Plural forms by CLDR category. Russian uses One, Few and Many, English One.
+	One, Few, Many string
+
+	// Gender variants
+	Feminine, Neutral string
+}
+
+// catalogs holds the messages of every language by key
+var catalogs = map[Lang]map[string]Message{
+	Russian: ru,
+	English: en,
+}
+
+// message looks a key up, falling back to Russian, which is complete
+func (l Lang) message(key string) (Message, bool) {
+	if message, ok := catalogs[l][key]; ok {
+		return message, true
+	}
+	message, ok := catalogs[Russian][key]
+	return message, ok
+}
+
+// T formats the message with the given key
+func (l Lang) T(key string, args ...interface{}) string {
+	message, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	return format(message.Other, args)
+}
+
+// N formats the plural form of a message that agrees with n. The count is
+// not added to args, so it has to be passed there as well if it is shown.
+func (l Lang) N(key string, n int, args ...interface{}) string {
+	message, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	text := message.Other
+	switch l.pluralCategory(n) {
+	case one:
+		text = pick(message.One, text)
+	case few:
+		text = pick(message.Few, text)
+	case many:
+		text = pick(message.Many, text)
+	}
+	return format(text, args)
+}
+
+// Count formats a counted noun such as "2 дня": the plural form of a
+// message that agrees with n, which is its only argument
+func (l Lang) Count(key string, n int) string {
+	return l.N(key, n, n)
+}
+
+// G formats the gender variant of a message
+func (l Lang) G(key string, gender Gender, args ...interface{}) string {
+	message, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	text := message.Other
+	switch gender {
+	case Feminine:
+		text = pick(message.Feminine, text)
+	case Neutral:
+		text = pick(message.Neutral, text)
+	}
+	return format(text, args)
+}
+
+// Missing returns the keys of a language's catalog that Russian lacks and
+// the keys of Russian the language lacks, so that gaps can be reported
+func (l Lang) Missing() (extra, missing []string) {
+	for key := range catalogs[l] {
+		if _, ok := catalogs[Russian][key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+	for key := range catalogs[Russian] {
+		if _, ok := catalogs[l][key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return extra, missing
+}
+
+func pick(text, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	return text
+}
+
+func format(text string, args []interface{}) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+type pluralCategory int
+
+const (
+	other pluralCategory = iota
+	one
+	few
+	many
+)
+
+// pluralCategory returns the CLDR plural category of a whole number
+func (l Lang) pluralCategory(n int) pluralCategory {
+	if n < 0 {
+		n = -n
+	}
+	switch l {
+	case Russian:
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return one
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return few
+		default:
+			return many
+		}
+	default:
+		if n == 1 {
+			return one
+		}
+		return other
+	}
+}
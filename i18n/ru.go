@@ -0,0 +1,248 @@
+package i18n
+
+// ru is the Russian catalog. It is complete: other languages fall back to it.
+var ru = map[string]Message{
+	"lang.name": {Other: "русский"},
+
+	// Help, see helpSections in the main package
+	"help.title":            {Other: "Как пользоваться ботом:"},
+	"help.recording":        {Other: "Запись долга"},
+	"help.debt":             {Other: "@username сумма [причина] - записать долг для одного человека"},
+	"help.split":            {Other: "@user1 @user2 сумма [причина] - разделить сумму между несколькими людьми"},
+	"help.all":              {Other: "@all сумма [причина] - разделить сумму между всеми участниками чата"},
+	"help.each":             {Other: "/each @username1 [@username2 ...] сумма [причина] - дать сумму в долг каждому из указанных пользователей"},
+	"help.due":              {Other: "@username сумма [причина] до ГГГГ-ММ-ДД - долг со сроком возврата, просроченные выделены в /balance и попадают в напоминания"},
+	"help.commands":         {Other: "Команды"},
+	"help.balance":          {Other: "/balance - показать все долги в чате"},
+	"help.balance_me":       {Other: "/balance me - показать ваши личные долги"},
+	"help.history":          {Other: "/history [дней] - показать историю операций (по умолчанию за 1 день)"},
+	"help.history_filters":  {Other: "/history @username, /history #тег, /history type:return - фильтры истории"},
+	"help.history_period":   {Other: "/history from 2026-09-01 to 2026-09-30 - история за период"},
+	"help.cancel":           {Other: "/cancel - отменить последнюю операцию"},
+	"help.remind":           {Other: "/remind on [daily|weekly] [дней] [dm] - регулярно напоминать о долгах старше стольких дней (по умолчанию раз в неделю о долгах старше 7 дней), с dm — лично каждому должнику"},
+	"help.remind_off":       {Other: "/remind off - выключить напоминания"},
+	"help.nudge":            {Other: "/nudge @username - вежливо напомнить человеку о его долге вам"},
+	"help.recurring":        {Other: "/recurring add daily|weekly 1-7|monthly 1-31 сообщение - записывать операцию по расписанию, например /recurring add monthly 1 @all 45000 аренда"},
+	"help.recurring_manage": {Other: "/recurring list, /recurring pause|resume|delete номер - регулярные операции чата"},
+	"help.stats":            {Other: "/stats [дней] - кто сколько заплатил и потребил, крупнейшие траты (по умолчанию за 30 дней)"},
+	"help.stats_categories": {Other: "/stats categories [дней] - траты по категориям (по умолчанию за 30 дней)"},
+	"help.export":           {Other: "/export csv|json [дней] - выгрузить все операции чата файлом"},
+	"help.timezone":         {Other: "/timezone [зона] - показать или задать часовой пояс чата, например Europe/Moscow"},
+	"help.gender":           {Other: "/gender m|f|n - как к вам обращаться: должен, должна или нейтрально (долг перед)"},
+	"help.lang":             {Other: "/lang ru|en - язык бота в этом чате"},
+	"help.import":           {Other: "/import - загрузить операции из CSV (экспорт Splitwise или /export csv)"},
+	"help.chart_balance":    {Other: "/chart balance - картинка с балансом участников"},
+	"help.chart_spending":   {Other: "/chart spending [дней] - картинка с тратами участников (по умолчанию за 30 дней)"},
+	"help.mybalance":        {Other: "/mybalance - в личном чате с ботом: ваш баланс во всех группах"},
+	"help.notify":           {Other: "/notify now|daily|mute - в личном чате с ботом: сообщать ли вам об операциях с вашим участием сразу, раз в день или никогда"},
+	"help.help":             {Other: "/help - показать это сообщение"},
+	"help.categories":       {Other: "Категории"},
+	"help.tags":             {Other: "#теги в причине сохраняются и задают категорию операции"},
+	"help.keywords":         {Other: "без тегов категория подбирается по словам причины"},
+	"help.examples":         {Other: "Примеры:"},
+	"help.examples.list":    {Other: "• @ivan 50 обед\n• @ivan @maria 100 ужин\n• @all 150 вечеринка\n• @all 2000 #продукты магнит\n• /history 30 - показать историю за 30 дней"},
+	"private.only":          {Other: "Долги записываются в групповых чатах — добавьте меня в групповой чат! Здесь /mybalance покажет ваш баланс во всех группах."},
+	"command.unknown":       {Other: "Неизвестная команда"},
+	"period.days":           {One: "за последний %d день", Few: "за последние %d дня", Many: "за последние %d дней"},
+	"period.today":          {Other: "за сегодня"},
+	"error.balance":         {Other: "Ошибка при подсчёте баланса. Пожалуйста, попробуйте снова."},
+	"error.cancel":          {Other: "Ошибка при отмене операции. Пожалуйста, попробуйте снова."},
+	"error.stats":           {Other: "Ошибка при получении статистики. Пожалуйста, попробуйте снова."},
+	"error.chart":           {Other: "Ошибка при построении графика. Пожалуйста, попробуйте снова."},
+	"error.export":          {Other: "Ошибка при выгрузке операций. Пожалуйста, попробуйте снова."},
+	"error.timezone":        {Other: "Ошибка при сохранении часового пояса. Пожалуйста, попробуйте снова."},
+	"error.gender":          {Other: "Ошибка при сохранении рода. Пожалуйста, попробуйте снова."},
+	"error.lang":            {Other: "Ошибка при сохранении языка. Пожалуйста, попробуйте снова."},
+	"error.operation":       {Other: "Ошибка при обработке операции. Пожалуйста, попробуйте снова."},
+	"error.members":         {Other: "Ошибка при получении списка участников. Пожалуйста, попробуйте снова."},
+	"error.remind":          {Other: "Ошибка при сохранении напоминания. Пожалуйста, попробуйте снова."},
+	"error.recurring":       {Other: "Ошибка при сохранении регулярной операции. Пожалуйста, попробуйте снова."},
+	"error.notify":          {Other: "Ошибка при сохранении настроек уведомлений. Пожалуйста, попробуйте снова."},
+	"error.history":         {Other: "Ошибка при получении истории. Пожалуйста, попробуйте снова."},
+	"error.download":        {Other: "Ошибка при загрузке файла. Пожалуйста, попробуйте снова."},
+
+	// Counted nouns for messages with several counts, see Lang.Count
+	"count.operations": {One: "%d операция", Few: "%d операции", Many: "%d операций"},
+	"count.records":    {One: "%d запись", Few: "%d записи", Many: "%d записей"},
+	"count.people":     {One: "%d участник", Few: "%d участника", Many: "%d участников"},
+	"count.rubles":     {One: "%d рубль", Few: "%d рубля", Many: "%d рублей"},
+	"count.kopecks":    {One: "%d копейка", Few: "%d копейки", Many: "%d копеек"},
+
+	// Ledger entries
+	"owes":              {Other: "%s должен %s %s", Feminine: "%s должна %s %s", Neutral: "%s — долг перед %s %s"},
+	"returned":          {Other: "%s вернул %s %s", Feminine: "%s вернула %s %s", Neutral: "%s — возврат %s %s"},
+	"returned_and_owes": {Other: "%s и теперь %s"},
+	"due":               {Other: "%s, вернуть до %s"},
+	"overdue":           {Other: "⚠️ %s — просрочено, срок был %s"},
+	"recorded.category": {Other: "Категория: %s"},
+	"recorded.due":      {Other: "Вернуть до %s"},
+	"due.past":          {Other: "Срок возврата %s уже прошёл. Укажите сегодняшнюю или более позднюю дату, например: @username 500 билеты до ГГГГ-ММ-ДД"},
+
+	// Recording
+	"each.usage":    {Other: "Использование: /each @username1 [@username2 ...] сумма [причина]"},
+	"each.no_users": {Other: "Не указаны пользователи. Использование: /each @username1 [@username2 ...] сумма [причина]"},
+	"each.done":     {One: "Добавлен долг %s для %d пользователя:", Other: "Добавлены долги по %s для %d пользователей:"},
+	"all.too_few":   {Other: "Недостаточно участников в чате."},
+	"all.done":      {One: "Разделено %s между %d участником (по %s каждый):", Other: "Разделено %s между %d участниками (по %s каждый):"},
+	"split.done":    {One: "Разделено %s между %d пользователем (по %s каждый):", Other: "Разделено %s между %d пользователями (по %s каждый):"},
+
+	// /balance
+	"balance.mine":      {Other: "Ваши долги:"},
+	"balance.mine.none": {Other: "У вас нет непогашенных долгов."},
+	"balance.chat":      {Other: "Долги в этом чате:"},
+	"balance.none":      {Other: "Нет непогашенных долгов."},
+
+	// /mybalance
+	"dashboard.total":    {Other: "Ваш баланс во всех чатах: %s"},
+	"dashboard.none":     {Other: "У вас нет непогашенных долгов ни в одном чате."},
+	"dashboard.untitled": {Other: "Чат %d"},
+	"dashboard.in_group": {Other: "Напишите /mybalance мне в личные сообщения, чтобы увидеть баланс во всех чатах."},
+
+	// /notify
+	"notify.current":     {Other: "Уведомления: %s.\nИзменить: /notify now|daily|mute"},
+	"notify.set":         {Other: "Уведомления: %s."},
+	"notify.usage":       {Other: "Используйте: /notify now — сразу, /notify daily — сводкой раз в день, /notify mute — не присылать"},
+	"notify.no_username": {Other: "Задайте себе имя пользователя в настройках Telegram — операции в группах записываются по нему."},
+	"notify.in_group":    {Other: "Напишите /notify мне в личные сообщения, чтобы получать уведомления об операциях с вашим участием."},
+	"notify.mode.now":    {Other: "сразу"},
+	"notify.mode.daily":  {Other: "сводкой раз в день"},
+	"notify.mode.mute":   {Other: "выключены"},
+	"notify.mode.unset":  {Other: "не включены"},
+	"notify.recorded":    {Other: "%s записал в «%s»:", Feminine: "%s записала в «%s»:", Neutral: "%s — новая запись в «%s»:"},
+	"notify.cancelled":   {Other: "%s отменил операцию в «%s»:", Feminine: "%s отменила операцию в «%s»:", Neutral: "%s — отмена операции в «%s»:"},
+	"notify.digest":      {Other: "Операции с вашим участием за день:"},
+
+	// /cancel
+	"cancel.nothing":    {Other: "В этом чате нет операций для отмены."},
+	"cancel.not_author": {Other: "Вы не можете отменить эту операцию. Операция была выполнена пользователем %s."},
+	"cancel.gone":       {Other: "Операция не найдена или уже была отменена."},
+	"cancel.done":       {Other: "Отменена последняя операция (ID: %d):"},
+	"cancel.deleted":    {One: "Удалена %d запись", Few: "Удалены %d записи", Many: "Удалено %d записей"},
+
+	// /remind, /nudge
+	"remind.usage":      {Other: "Использование: /remind on [daily|weekly] [дней] [dm] или /remind off"},
+	"remind.off":        {Other: "Напоминания о долгах выключены. Включить: /remind on [daily|weekly] [дней] [dm]"},
+	"remind.on":         {One: "Напоминания: %s о долгах старше %d дня, %s. Следующее: %s.", Few: "Напоминания: %s о долгах старше %d дней, %s. Следующее: %s.", Many: "Напоминания: %s о долгах старше %d дней, %s. Следующее: %s."},
+	"remind.to_chat":    {Other: "в этот чат"},
+	"remind.to_debtors": {Other: "лично каждому должнику"},
+	"remind.title":      {One: "Напоминание о долгах старше %d дня и просроченных:", Few: "Напоминание о долгах старше %d дней и просроченных:", Many: "Напоминание о долгах старше %d дней и просроченных:"},
+	"remind.direct":     {Other: "Напоминание о ваших долгах в «%s»:"},
+	"remind.since":      {Other: "%s, с %s"},
+	"nudge.usage":       {Other: "Использование: /nudge @username — напомнить человеку о его долге вам"},
+	"nudge.text":        {Other: "@%s, дружеское напоминание от %s:\n%s"},
+	"nudge.none":        {Other: "%s ничего вам не должен.", Feminine: "%s ничего вам не должна.", Neutral: "%s — долгов перед вами нет."},
+	"frequency.daily":   {Other: "ежедневно"},
+	"frequency.weekly":  {Other: "еженедельно"},
+
+	// /recurring
+	"recurring.usage":       {Other: "Использование:\n/recurring add daily|weekly 1-7|monthly 1-31 @username сумма [причина]\n/recurring list\n/recurring pause|resume|delete номер\nНапример: /recurring add monthly 1 @all 45000 аренда"},
+	"recurring.day":         {Other: "Укажите день от 1 до %d: для weekly 1 — понедельник, для monthly — число месяца."},
+	"recurring.due":         {Other: "Регулярная операция не может иметь срок возврата: он прошёл бы, а записи продолжались. Уберите «до ГГГГ-ММ-ДД» из сообщения."},
+	"recurring.added":       {Other: "Регулярная операция #%d: %s «%s». Первая запись: %s."},
+	"recurring.none":        {Other: "В этом чате нет регулярных операций."},
+	"recurring.list":        {Other: "Регулярные операции:"},
+	"recurring.item":        {Other: "#%d %s: %s (%s), следующая запись %s"},
+	"recurring.item.paused": {Other: "#%d %s: %s (%s), на паузе"},
+	"recurring.not_found":   {Other: "Регулярная операция #%d не найдена."},
+	"recurring.not_author":  {Other: "Вы не можете изменить эту регулярную операцию. Её добавил %s."},
+	"recurring.paused":      {Other: "Регулярная операция #%d на паузе."},
+	"recurring.resumed":     {Other: "Регулярная операция #%d снова работает."},
+	"recurring.deleted":     {Other: "Регулярная операция #%d удалена."},
+	"recurring.ran":         {Other: "Регулярная операция #%d «%s» за %s:"},
+	"schedule.monthly":      {Other: "ежемесячно %d-го числа"},
+	"schedule.weekly.1":     {Other: "по понедельникам"},
+	"schedule.weekly.2":     {Other: "по вторникам"},
+	"schedule.weekly.3":     {Other: "по средам"},
+	"schedule.weekly.4":     {Other: "по четвергам"},
+	"schedule.weekly.5":     {Other: "по пятницам"},
+	"schedule.weekly.6":     {Other: "по субботам"},
+	"schedule.weekly.7":     {Other: "по воскресеньям"},
+
+	// /history
+	"history.usage":      {Other: "Использование: /history [дней] [@username] [#тег] [from ГГГГ-ММ-ДД] [to ГГГГ-ММ-ДД] [type:debt|return]"},
+	"history.from":       {Other: "с %s"},
+	"history.to":         {Other: "по %s"},
+	"history.user":       {Other: "с участием %s"},
+	"history.tag":        {Other: "с тегом #%s"},
+	"history.debts":      {Other: "только долги"},
+	"history.returns":    {Other: "только возвраты"},
+	"history.empty":      {Other: "Нет операций %s."},
+	"history.title":      {Other: "История операций %s"},
+	"history.page":       {Other: " (стр. %d из %d)"},
+	"history.no_buttons": {Other: "Листать страницы с этим фильтром нельзя: он слишком длинный. Сократите его или укажите период."},
+	"history.expired":    {Other: "Эти кнопки устарели. Отправьте /history снова."},
+
+	// /stats
+	"stats.usage":      {Other: "Использование: /stats [дней] или /stats categories [дней]"},
+	"stats.empty":      {Other: "Нет операций %s."},
+	"stats.categories": {Other: "Траты по категориям %s:"},
+	"stats.category":   {Other: "• %s: %s (%s)"},
+	"stats.total":      {Other: "Всего: %s"},
+	"stats.title":      {Other: "Статистика %s:"},
+	"stats.members":    {Other: "Участники (оплачено / потреблено / итог):"},
+	"stats.member":     {Other: "%d. %s: %s / %s / %s"},
+	"stats.largest":    {Other: "Крупнейшие траты:"},
+	"stats.busiest":    {Other: "Самые активные дни:"},
+	"stats.day":        {Other: "• %s: %s на %s"},
+
+	// /chart
+	"chart.usage":    {Other: "Использование: /chart balance или /chart spending [дней]"},
+	"chart.no_debts": {Other: "В этом чате нет непогашенных долгов."},
+	"chart.balance":  {Other: "Баланс"},
+	"chart.spending": {Other: "Траты %s"},
+	"chart.owed":     {Other: "им должны"},
+	"chart.owes":     {Other: "они должны"},
+	"chart.paid":     {Other: "оплачено"},
+	"chart.consumed": {Other: "потреблено"},
+
+	// /export
+	"export.usage":   {Other: "Использование: /export csv|json [дней]"},
+	"export.empty":   {Other: "В этом чате нет операций для выгрузки."},
+	"export.caption": {One: "Выгружена %d запись", Few: "Выгружены %d записи", Many: "Выгружено %d записей"},
+
+	// /timezone
+	"timezone.current": {Other: "Часовой пояс чата: %s\nИзменить: /timezone Europe/Moscow"},
+	"timezone.unknown": {Other: "Неизвестный часовой пояс. Пример: /timezone Europe/Moscow"},
+	"timezone.set":     {Other: "Часовой пояс чата: %s. Сейчас %s."},
+
+	// /gender
+	"gender.no_username": {Other: "Чтобы выбрать род, задайте себе username в настройках Telegram."},
+	"gender.current":     {Other: "Род для %s: %s\nИзменить: /gender m, /gender f или /gender n"},
+	"gender.usage":       {Other: "Использование: /gender m (должен), /gender f (должна) или /gender n (нейтрально)"},
+	"gender.set":         {Other: "Род для %s: %s"},
+	"gender.name":        {Other: "мужской (должен, вернул)", Feminine: "женский (должна, вернула)", Neutral: "нейтральный (долг перед, возврат)"},
+
+	// /lang
+	"lang.current": {Other: "Язык чата: %s\nИзменить: /lang ru или /lang en"},
+	"lang.usage":   {Other: "Использование: /lang ru или /lang en"},
+	"lang.set":     {Other: "Язык чата: %s"},
+
+	// /import
+	"import.busy":              {Other: "В этом чате уже идёт импорт другого пользователя."},
+	"import.send_file":         {Other: "Пришлите CSV-файл: экспорт из Splitwise или файл из /export csv."},
+	"import.nothing_to_cancel": {Other: "Нет импорта для отмены."},
+	"import.cancelled":         {Other: "Импорт отменён."},
+	"import.not_ready":         {Other: "Нет импорта, готового к записи."},
+	"import.failed":            {Other: "Ошибка при импорте, ничего не записано. Пожалуйста, попробуйте снова."},
+	"import.done":              {Other: "Импорт завершён. Записано: %s (%s)."},
+	"import.duplicates":        {Other: "Уже были в чате и пропущены: %s."},
+	"import.usage":             {Other: "Использование: /import, затем /import confirm или /import cancel"},
+	"import.too_big":           {Other: "Файл слишком большой для импорта."},
+	"import.parse_failed":      {Other: "Не удалось разобрать файл: %s"},
+	"import.empty":             {Other: "В файле нет операций для импорта."},
+	"import.found":             {Other: "Найдено: %s, %s."},
+	"import.ask":               {Other: "Кто в этом чате «%s»? Ответьте @username или «-», чтобы пропустить его операции."},
+	"import.members":           {Other: "Участники: %s"},
+	"import.mapping":           {Other: "Сопоставление участников:"},
+	"import.skip":              {Other: "пропустить"},
+	"import.summary":           {Other: "Будет записано: %s (%s) на сумму %s."},
+	"import.confirm":           {Other: "Отправьте /import confirm для записи или /import cancel для отмены."},
+	"import.error.empty":       {Other: "файл пуст"},
+	"import.error.format":      {Other: "неизвестный формат, ожидается экспорт Splitwise или /export csv"},
+	"import.error.fields":      {One: "строка %d: ожидается %d поле", Few: "строка %d: ожидается %d поля", Many: "строка %d: ожидается %d полей"},
+	"import.error.time":        {Other: "строка %d: неверное время %q"},
+	"import.error.date":        {Other: "строка %d: неверная дата %q"},
+	"import.error.amount":      {Other: "строка %d: неверная сумма %q"},
+	"import.error.type":        {Other: "строка %d: неизвестный тип операции %q"},
+	"import.error.currency":    {Other: "строка %d: валюта %s, а учёт ведётся в %s"},
+}
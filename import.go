@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// maxImportSize limits the size of an uploaded ledger
+const maxImportSize = 5 << 20
+
+// importSession is an import in progress in a chat. Only the user who started
+// it can upload the file, map names and confirm it.
+type importSession struct {
+	UserID     int64
+	Waiting    bool
+	Operations []importedOperation
+	Names      []string
+	Mapping    map[string]string
+}
+
+// importedOperation is one expense or payment read from an uploaded ledger
+type importedOperation struct {
+	Time   time.Time
+	Reason string
+	Rows   []importedRow
+}
+
+// importedRow is a single debt between two names from the uploaded ledger
+type importedRow struct {
+	Creditor string
+	Debtor   string
+	Amount   int
+	Type     string
+	Due      time.Time // zero if none
+}
+
+// importSessions holds the import in progress for every chat. A session is
+// only used by the worker of its chat, but the map is shared by all workers.
+var (
+	importSessionsMu sync.Mutex
+	importSessions   = make(map[int64]*importSession)
+)
+
+// getImportSession returns the import in progress in a chat, or nil
+func getImportSession(chatID int64) *importSession {
+	importSessionsMu.Lock()
+	defer importSessionsMu.Unlock()
+	return importSessions[chatID]
+}
+
+// setImportSession starts or replaces the import in progress in a chat; nil ends it
+func setImportSession(chatID int64, session *importSession) {
+	importSessionsMu.Lock()
+	defer importSessionsMu.Unlock()
+	if session == nil {
+		delete(importSessions, chatID)
+		return
+	}
+	importSessions[chatID] = session
+}
+
+var importMappingRe = regexp.MustCompile(`^\s*(?:@(\w+)|-)\s*$`)
+
+// handleImportCommand handles /import, /import confirm and /import cancel
+func handleImportCommand(bot telegramClient, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	lang := getChatLang(chatID)
+	session := getImportSession(chatID)
+
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "":
+		if session != nil && session.UserID != message.From.ID {
+			bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.busy")))
+			return
+		}
+		setImportSession(chatID, &importSession{UserID: message.From.ID, Waiting: true})
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.send_file")))
+	case "cancel":
+		if session == nil || session.UserID != message.From.ID {
+			bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.nothing_to_cancel")))
+			return
+		}
+		setImportSession(chatID, nil)
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.cancelled")))
+	case "confirm":
+		if session == nil || session.UserID != message.From.ID || session.Waiting || nextUnmappedName(session) != "" {
+			bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.not_ready")))
+			return
+		}
+		setImportSession(chatID, nil)
+		operations, rows, skipped, err := applyImport(chatID, session)
+		if err != nil {
+			log.Printf("Error applying import: %v", err)
+			bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.failed")))
+			return
+		}
+		text := lang.T("import.done", lang.Count("count.operations", operations), lang.Count("count.records", rows))
+		if skipped > 0 {
+			text += "\n" + lang.T("import.duplicates", lang.Count("count.operations", skipped))
+		}
+		bot.Send(tgbotapi.NewMessage(chatID, text))
+	default:
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.usage")))
+	}
+}
+
+// isImportUpload reports whether a message carries the file of an import
+func isImportUpload(message *tgbotapi.Message) bool {
+	if message.Document == nil {
+		return false
+	}
+	if strings.HasPrefix(message.Caption, "/import") {
+		return true
+	}
+	session := getImportSession(message.Chat.ID)
+	return session != nil && session.Waiting && session.UserID == message.From.ID
+}
+
+// handleImportUpload downloads and parses an uploaded ledger, then starts mapping its names
+func handleImportUpload(bot telegramClient, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	lang := getChatLang(chatID)
+	if session := getImportSession(chatID); session != nil && session.UserID != message.From.ID {
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.busy")))
+		return
+	}
+	if message.Document.FileSize > maxImportSize {
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.too_big")))
+		return
+	}
+
+	data, err := bot.DownloadFile(message.Document.FileID)
+	if err != nil {
+		log.Printf("Error downloading import file: %v", err)
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("error.download")))
+		return
+	}
+
+	operations, names, err := parseLedgerCSV(data, getChatLocation(chatID))
+	if err != nil {
+		reason := err.Error()
+		var parseErr *importError
+		if errors.As(err, &parseErr) {
+			reason = parseErr.text(lang)
+		}
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.parse_failed", reason)))
+		return
+	}
+	if len(operations) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.empty")))
+		return
+	}
+
+	session := &importSession{
+		UserID:     message.From.ID,
+		Operations: operations,
+		Names:      names,
+		Mapping:    make(map[string]string),
+	}
+	members := append(getChatMembers(chatID), message.From.UserName)
+	admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		log.Printf("Error getting chat administrators: %v", err)
+	}
+	for _, admin := range admins {
+		if !admin.User.IsBot && admin.User.UserName != "" {
+			members = append(members, admin.User.UserName)
+		}
+	}
+	for _, name := range names {
+		for _, member := range members {
+			if strings.EqualFold(strings.TrimPrefix(name, "@"), member) {
+				session.Mapping[name] = member
+			}
+		}
+	}
+	setImportSession(chatID, session)
+
+	bot.Send(tgbotapi.NewMessage(chatID, lang.T("import.found", lang.Count("count.operations", len(operations)), lang.Count("count.people", len(names)))))
+	askImportMapping(bot, chatID, session)
+}
+
+// handleImportMapping treats "@username" or "-" from the importing user as the
+// answer to the last mapping question. It reports whether the message was consumed.
+func handleImportMapping(bot telegramClient, message *tgbotapi.Message) bool {
+	session := getImportSession(message.Chat.ID)
+	if session == nil || session.Waiting || session.UserID != message.From.ID {
+		return false
+	}
+	name := nextUnmappedName(session)
+	if name == "" {
+		return false
+	}
+	matches := importMappingRe.FindStringSubmatch(message.Text)
+	if matches == nil {
+		return false
+	}
+
+	// An empty mapping means the name is skipped along with its rows
+	session.Mapping[name] = matches[1]
+	askImportMapping(bot, message.Chat.ID, session)
+	return true
+}
+
+// askImportMapping asks about the next unmapped name or shows the import summary
+func askImportMapping(bot telegramClient, chatID int64, session *importSession) {
+	lang := getChatLang(chatID)
+	if name := nextUnmappedName(session); name != "" {
+		text := lang.T("import.ask", name)
+		if members := getChatMembers(chatID); len(members) > 0 {
+			text += "\n\n" + lang.T("import.members", "@"+strings.Join(members, ", @"))
+		}
+		bot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+
+	var response strings.Builder
+	response.WriteString(lang.T("import.mapping") + "\n")
+	for _, name := range session.Names {
+		if username := session.Mapping[name]; username != "" {
+			response.WriteString(fmt.Sprintf("• %s → @%s\n", name, username))
+		} else {
+			response.WriteString(fmt.Sprintf("• %s → %s\n", name, lang.T("import.skip")))
+		}
+	}
+	operations, rows, total := 0, 0, 0
+	for _, operation := range session.Operations {
+		mapped := mapImportedRows(operation.Rows, session.Mapping)
+		if len(mapped) > 0 {
+			operations++
+		}
+		for _, row := range mapped {
+			rows++
+			total += row.Amount
+		}
+	}
+	response.WriteString("\n" + lang.T("import.summary", lang.Count("count.operations", operations), lang.Count("count.records", rows), formatAmount(lang, total)) + "\n")
+	response.WriteString(lang.T("import.confirm"))
+	bot.Send(tgbotapi.NewMessage(chatID, response.String()))
+}
+
+// nextUnmappedName returns the first name of the import that has no answer yet
+func nextUnmappedName(session *importSession) string {
+	for _, name := range session.Names {
+		if _, ok := session.Mapping[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// mapImportedRows replaces names with usernames, dropping rows with skipped names
+func mapImportedRows(rows []importedRow, mapping map[string]string) []importedRow {
+	var mapped []importedRow
+	for _, row := range rows {
+		creditor, debtor := mapping[row.Creditor], mapping[row.Debtor]
+		if creditor == "" || debtor == "" || creditor == debtor {
+			continue
+		}
+		mapped = append(mapped, importedRow{Creditor: creditor, Debtor: debtor, Amount: row.Amount, Type: row.Type, Due: row.Due})
+	}
+	return mapped
+}
+
+// importedEntryKey identifies an entry when looking for operations that were
+// imported before
+type importedEntryKey struct {
+	From, To, Type, Reason string
+	Amount                 int
+	Time                   int64
+}
+
+// applyImport records the operations of a fully mapped import in a chat in a
+// single transaction. Operations whose every entry is already in the chat,
+// such as those of a file imported before, are skipped.
+func applyImport(chatID int64, session *importSession) (operations, rows, skipped int, err error) {
+	var pending []ledger.Pending
+	for _, operation := range session.Operations {
+		mapped := mapImportedRows(operation.Rows, session.Mapping)
+		if len(mapped) == 0 {
+			continue
+		}
+		var entries []storage.Entry
+		for _, row := range mapped {
+			entries = append(entries, storage.Entry{
+				From:   row.Creditor,
+				To:     row.Debtor,
+				Amount: row.Amount,
+				Reason: operation.Reason,
+				Type:   row.Type,
+				Time:   operation.Time,
+				Due:    row.Due,
+			})
+		}
+		pending = append(pending, ledger.Pending{Entries: entries, Reason: operation.Reason})
+	}
+	if len(pending) == 0 {
+		return 0, 0, 0, nil
+	}
+
+	since := pending[0].Entries[0].Time
+	for _, p := range pending {
+		if p.Entries[0].Time.Before(since) {
+			since = p.Entries[0].Time
+		}
+	}
+	existing, err := store.Entries(chatID, since)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	available := make(map[importedEntryKey]int)
+	for _, entry := range existing {
+		available[importedKey(entry)]++
+	}
+
+	var fresh []ledger.Pending
+	for _, p := range pending {
+		keys := make(map[importedEntryKey]int)
+		duplicate := true
+		for _, entry := range p.Entries {
+			key := importedKey(entry)
+			keys[key]++
+			if keys[key] > available[key] {
+				duplicate = false
+			}
+		}
+		if !duplicate {
+			fresh = append(fresh, p)
+			rows += len(p.Entries)
+			continue
+		}
+		// Every existing entry stands in for a single imported one
+		for key, n := range keys {
+			available[key] -= n
+		}
+		skipped++
+	}
+
+	if _, err := chatLedger.RecordAll(chatID, fresh); err != nil {
+		return 0, 0, 0, err
+	}
+	return len(fresh), rows, skipped, nil
+}
+
+// importedKey returns the key of an entry, with its time at the precision
+// the store keeps
+func importedKey(entry storage.Entry) importedEntryKey {
+	return importedEntryKey{
+		From:   entry.From,
+		To:     entry.To,
+		Type:   entry.Type,
+		Reason: entry.Reason,
+		Amount: entry.Amount,
+		Time:   entry.Time.Unix(),
+	}
+}
+
+// getChatMembers returns the usernames that appear in a chat's ledger
+func getChatMembers(chatID int64) []string {
+	members, err := store.Members(chatID)
+	if err != nil {
+		log.Printf("Error querying chat members: %v", err)
+		return nil
+	}
+	return members
+}
+
+// importError is a problem with the contents of an uploaded ledger, reported
+// to the chat as a catalog message. Count selects its plural form.
+type importError struct {
+	Key   string
+	Count int
+	Args  []interface{}
+}
+
+func newImportError(key string, args ...interface{}) *importError {
+	return &importError{Key: key, Args: args}
+}
+
+// newFieldCountError reports a row with the wrong number of fields
+func newFieldCountError(line, fields int) *importError {
+	return &importError{Key: "import.error.fields", Count: fields, Args: []interface{}{line, fields}}
+}
+
+// text renders the error in a language
+func (e *importError) text(lang i18n.Lang) string {
+	return lang.N(e.Key, e.Count, e.Args...)
+}
+
+func (e *importError) Error() string {
+	return e.text(i18n.Russian)
+}
+
+// parseLedgerCSV detects the format of an uploaded CSV and returns its
+// operations together with every name that appears in them. Dates without a
+// time zone are read in loc.
+func parseLedgerCSV(data []byte, loc *time.Location) ([]importedOperation, []string, error) {
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\ufeff")))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, &importError{Key: "import.error.empty"}
+	}
+
+	header := records[0]
+	var operations []importedOperation
+	switch {
+	case strings.Join(header, ",") == strings.Join(exportHeader, ","),
+		strings.Join(header, ",") == strings.Join(exportHeader[:len(exportHeader)-1], ","):
+		operations, err = parseExportRecords(records[1:], len(header))
+	case len(header) > 5 && strings.EqualFold(header[0], "Date") && strings.EqualFold(header[3], "Cost"):
+		operations, err = parseSplitwiseRecords(header, records[1:], loc)
+	default:
+		return nil, nil, &importError{Key: "import.error.format"}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, operation := range operations {
+		for _, row := range operation.Rows {
+			for _, name := range []string{row.Creditor, row.Debtor} {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return operations, names, nil
+}
+
+// parseExportRecords reads rows produced by /export csv, grouping them by
+// operation ID. Exports made before the due column have one column less.
+func parseExportRecords(records [][]string, columns int) ([]importedOperation, error) {
+	var operations []importedOperation
+	byID := make(map[string]int)
+	for i, record := range records {
+		if len(record) != columns {
+			return nil, newFieldCountError(i+2, columns)
+		}
+		createdAt, err := time.Parse(time.RFC3339, record[1])
+		if err != nil {
+			return nil, newImportError("import.error.time", i+2, record[1])
+		}
+		amount, err := parseImportAmount(record[4])
+		if err != nil || amount <= 0 {
+			return nil, newImportError("import.error.amount", i+2, record[4])
+		}
+		opType := record[5]
+		if opType != "debt" && opType != "return" {
+			return nil, newImportError("import.error.type", i+2, opType)
+		}
+		var due time.Time
+		if columns > 7 && record[7] != "" {
+			if due, err = time.Parse("2006-01-02", record[7]); err != nil {
+				return nil, newImportError("import.error.date", i+2, record[7])
+			}
+		}
+
+		index, ok := byID[record[0]]
+		if !ok {
+			index = len(operations)
+			byID[record[0]] = index
+			operations = append(operations, importedOperation{Time: createdAt, Reason: unescapeCSVCell(record[6])})
+		}
+		operations[index].Rows = append(operations[index].Rows, importedRow{
+			Creditor: unescapeCSVCell(record[2]),
+			Debtor:   unescapeCSVCell(record[3]),
+			Amount:   amount,
+			Type:     opType,
+			Due:      due,
+		})
+	}
+	return operations, nil
+}
+
+// parseSplitwiseRecords reads a Splitwise export. Every expense row holds the
+// net share of each person: positive for those who paid more than their
+// share and negative for those who owe. Shares are settled greedily into
+// debts from the biggest debtor to the biggest creditor.
+func parseSplitwiseRecords(header []string, records [][]string, loc *time.Location) ([]importedOperation, error) {
+	people := header[5:]
+	var operations []importedOperation
+	for i, record := range records {
+		if len(record) < 5 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(record[1]), "Total balance") {
+			continue
+		}
+		if len(record) != len(header) {
+			return nil, newFieldCountError(i+2, len(header))
+		}
+		createdAt, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(record[0]), loc)
+		if err != nil {
+			return nil, newImportError("import.error.date", i+2, record[0])
+		}
+		// Amounts are taken as they are, so they must be in the bot's currency
+		if currency := strings.TrimSpace(record[4]); currency != "" && !strings.EqualFold(currency, cfg.Currency) {
+			return nil, newImportError("import.error.currency", i+2, currency, cfg.Currency)
+		}
+
+		type share struct {
+			name   string
+			amount int
+		}
+		var creditors, debtors []share
+		for j, person := range people {
+			amount, err := parseImportAmount(record[5+j])
+			if err != nil {
+				return nil, newImportError("import.error.amount", i+2, record[5+j])
+			}
+			if amount > 0 {
+				creditors = append(creditors, share{person, amount})
+			} else if amount < 0 {
+				debtors = append(debtors, share{person, -amount})
+			}
+		}
+		sort.SliceStable(creditors, func(a, b int) bool { return creditors[a].amount > creditors[b].amount })
+		sort.SliceStable(debtors, func(a, b int) bool { return debtors[a].amount > debtors[b].amount })
+
+		// Payments settle existing debts rather than create new ones
+		opType := "debt"
+		if strings.EqualFold(strings.TrimSpace(record[2]), "Payment") {
+			opType = "return"
+		}
+
+		operation := importedOperation{Time: createdAt, Reason: strings.TrimSpace(record[1])}
+		for c, d := 0, 0; c < len(creditors) && d < len(debtors); {
+			amount := creditors[c].amount
+			if debtors[d].amount < amount {
+				amount = debtors[d].amount
+			}
+			operation.Rows = append(operation.Rows, importedRow{
+				Creditor: creditors[c].name,
+				Debtor:   debtors[d].name,
+				Amount:   amount,
+				Type:     opType,
+			})
+			creditors[c].amount -= amount
+			debtors[d].amount -= amount
+			if creditors[c].amount == 0 {
+				c++
+			}
+			if debtors[d].amount == 0 {
+				d++
+			}
+		}
+		if len(operation.Rows) > 0 {
+			operations = append(operations, operation)
+		}
+	}
+	return operations, nil
+}
+
+// parseImportAmount parses a signed decimal amount such as "-12.5" into kopecks
+func parseImportAmount(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	sign := 1
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+		value = value[1:]
+	}
+	parts := strings.SplitN(value, ".", 2)
+	rubles, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	kopecks := 0
+	if len(parts) == 2 {
+		fraction := (parts[1] + "00")[:2]
+		if kopecks, err = strconv.Atoi(fraction); err != nil {
+			return 0, err
+		}
+	}
+	return sign * (rubles*100 + kopecks), nil
+}
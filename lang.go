@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"obshyakBot3/i18n"
+)
+
+// getChatLang returns the language a chat is answered in, defaulting to the configured locale
+func getChatLang(chatID int64) i18n.Lang {
+	code, err := store.ChatLanguage(chatID)
+	if err != nil {
+		log.Printf("Error getting chat language: %v", err)
+	}
+	if lang, ok := i18n.Parse(code); ok {
+		return lang
+	}
+	lang, _ := i18n.Parse(cfg.Locale)
+	return lang
+}
+
+// langCommand handles /lang in a chat, showing or changing its language
+func langCommand(chatID int64, args string, lang i18n.Lang) string {
+	args = strings.ToLower(strings.TrimSpace(args))
+	if args == "" {
+		return lang.T("lang.current", lang.T("lang.name"))
+	}
+	chosen, ok := i18n.Parse(args)
+	if !ok {
+		return lang.T("lang.usage")
+	}
+	if err := store.SetChatLanguage(chatID, string(chosen)); err != nil {
+		log.Printf("Error saving chat language: %v", err)
+		return lang.T("error.lang")
+	}
+	return chosen.T("lang.set", chosen.T("lang.name"))
+}
+
+// describePeriod describes the last days of a stats or history period, e.g.
+// "за последние 2 дня". A period of 1 day starts at midnight, so it is today.
+func describePeriod(lang i18n.Lang, days int) string {
+	if days == 1 {
+		return lang.T("period.today")
+	}
+	return lang.N("period.days", days, days)
+}
+
+// helpSection is a numbered section of /help listing catalog messages
+type helpSection struct {
+	Title string
+	Items []string
+}
+
+// helpSections lays out /help. Titles and items are keys of the message catalog.
+var helpSections = []helpSection{
+	{"help.recording", []string{"help.debt", "help.split", "help.all", "help.each", "help.due"}},
+	{"help.commands", []string{
+		"help.balance", "help.balance_me",
+		"help.history", "help.history_filters", "help.history_period",
+		"help.cancel",
+		"help.remind", "help.remind_off", "help.nudge",
+		"help.recurring", "help.recurring_manage",
+		"help.stats", "help.stats_categories",
+		"help.export",
+		"help.timezone", "help.gender", "help.lang",
+		"help.import",
+		"help.chart_balance", "help.chart_spending",
+		"help.mybalance", "help.notify",
+		"help.help",
+	}},
+	{"help.categories", []string{"help.tags", "help.keywords"}},
+}
+
+// renderHelp builds the /help text in a language
+func renderHelp(lang i18n.Lang) string {
+	var help strings.Builder
+	help.WriteString(lang.T("help.title") + "\n\n")
+	for i, section := range helpSections {
+		help.WriteString(fmt.Sprintf("%d. %s:\n", i+1, lang.T(section.Title)))
+		for _, item := range section.Items {
+			help.WriteString("   • " + lang.T(item) + "\n")
+		}
+		help.WriteString("\n")
+	}
+	help.WriteString(lang.T("help.examples") + "\n")
+	help.WriteString(lang.T("help.examples.list"))
+	return help.String()
+}
+
+// checkCatalogs warns about messages missing from or unknown to the catalogs,
+// which fall back to Russian or are never shown
+func checkCatalogs() {
+	for _, lang := range i18n.Langs {
+		extra, missing := lang.Missing()
+		sort.Strings(extra)
+		sort.Strings(missing)
+		if len(missing) > 0 {
+			logf(levelWarn, "Catalog %s lacks %s, Russian is used instead", lang, strings.Join(missing, ", "))
+		}
+		if len(extra) > 0 {
+			logf(levelWarn, "Catalog %s has unknown messages %s", lang, strings.Join(extra, ", "))
+		}
+	}
+}
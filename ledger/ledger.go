@@ -0,0 +1,371 @@
+// Package ledger holds the rules of the shared ledger independently of
+// Telegram: how a split turns into returns and new debts, how balances net
+// out and who may cancel an operation. Results are plain values that the
+// transport layer renders.
+package ledger
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+var (
+	// ErrNothingToCancel is returned by Cancel when a chat has no operations
+	ErrNothingToCancel = errors.New("ledger: nothing to cancel")
+	// ErrAlreadyCancelled is returned by Cancel when the operation disappeared
+	// before it could be deleted
+	ErrAlreadyCancelled = errors.New("ledger: operation already cancelled")
+)
+
+// NotAuthorError is returned by Cancel when someone other than the author of
+// the latest operation tries to cancel it
+type NotAuthorError struct {
+	Author string
+}
+
+func (e *NotAuthorError) Error() string {
+	return "ledger: operation was recorded by " + e.Author
+}
+
+// Ledger applies the ledger rules on top of a store
+type Ledger struct {
+	store storage.Store
+}
+
+// New returns a ledger backed by store
+func New(store storage.Store) *Ledger {
+	return &Ledger{store: store}
+}
+
+// Split is a payment made by Payer that each of Debtors owes Share of
+type Split struct {
+	ChatID  int64
+	Payer   string
+	Debtors []string // the payer is skipped if listed
+	Share   int
+	Reason  string
+	Time    time.Time // when the payment was made, now if zero
+	Due     time.Time // date the new debts are to be returned by, zero if none
+}
+
+// Share is what a split meant for a single debtor. Returned is the part that
+// paid back what the payer already owed the debtor and Owed is the new debt
+// of the debtor to the payer; either may be zero.
+type Share struct {
+	Debtor   string
+	Returned int
+	Owed     int
+}
+
+// Recorded describes a saved operation. OperationID is zero when there was
+// nothing to save.
+type Recorded struct {
+	OperationID int
+	Category    string
+	Shares      []Share
+	Due         time.Time
+}
+
+// RecordSplit records a split as a single operation. A share first pays back
+// what the payer owes the debtor and only the rest becomes a new debt.
+func (l *Ledger) RecordSplit(split Split) (Recorded, error) {
+	var result Recorded
+	var entries []storage.Entry
+	now := split.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for _, debtor := range split.Debtors {
+		if debtor == split.Payer {
+			continue
+		}
+		net, err := l.store.NetBalance(split.ChatID, split.Payer, debtor)
+		if err != nil {
+			return Recorded{}, err
+		}
+
+		share := Share{Debtor: debtor}
+		if net < 0 {
+			share.Returned = min(split.Share, -net)
+			entries = append(entries, storage.Entry{
+				From:   split.Payer,
+				To:     debtor,
+				Amount: share.Returned,
+				Reason: split.Reason,
+				Type:   storage.TypeReturn,
+				Time:   now,
+			})
+		}
+		share.Owed = split.Share - share.Returned
+		if net >= 0 || share.Owed > 0 {
+			entries = append(entries, storage.Entry{
+				From:   split.Payer,
+				To:     debtor,
+				Amount: share.Owed,
+				Reason: split.Reason,
+				Type:   storage.TypeDebt,
+				Time:   now,
+				Due:    split.Due,
+			})
+		}
+		result.Shares = append(result.Shares, share)
+	}
+
+	recorded, err := l.Record(split.ChatID, entries, split.Reason)
+	if err != nil {
+		return Recorded{}, err
+	}
+	result.OperationID = recorded.OperationID
+	result.Category = recorded.Category
+	result.Due = split.Due
+	return result, nil
+}
+
+// Record saves prepared entries, such as imported ones, as a single operation
+// tagged and categorized by its reason. Returns without a reason pay back
+// earlier debts and are categorized as repayments. Nothing is saved without
+// entries.
+func (l *Ledger) Record(chatID int64, entries []storage.Entry, reason string) (Recorded, error) {
+	if len(entries) == 0 {
+		return Recorded{}, nil
+	}
+	recorded, err := l.RecordAll(chatID, []Pending{{Entries: entries, Reason: reason}})
+	if err != nil {
+		return Recorded{}, err
+	}
+	return recorded[0], nil
+}
+
+// Pending is an operation prepared for RecordAll
+type Pending struct {
+	Entries []storage.Entry
+	Reason  string
+}
+
+// RecordAll saves several operations like Record, all of them or none.
+// Operations without entries are skipped.
+func (l *Ledger) RecordAll(chatID int64, pending []Pending) ([]Recorded, error) {
+	var ops []storage.Operation
+	for _, p := range pending {
+		if len(p.Entries) == 0 {
+			continue
+		}
+		tags := extractTags(p.Reason)
+		op := storage.Operation{
+			ChatID:   chatID,
+			Entries:  p.Entries,
+			Tags:     tags,
+			Category: suggestCategory(p.Reason, tags),
+		}
+		if p.Reason == "" && isRepayment(p.Entries) {
+			op.Category = storage.RepaymentCategory
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	ids, err := l.store.SaveOperations(ops)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make([]Recorded, len(ops))
+	for i, op := range ops {
+		recorded[i] = Recorded{OperationID: ids[i], Category: op.Category}
+	}
+	return recorded, nil
+}
+
+// isRepayment reports whether every entry is a return
+func isRepayment(entries []storage.Entry) bool {
+	for _, entry := range entries {
+		if entry.Type != storage.TypeReturn {
+			return false
+		}
+	}
+	return true
+}
+
+// Balance is the outstanding debt of Debtor to Creditor after netting out
+// everything between the two
+type Balance struct {
+	Debtor   string
+	Creditor string
+	Amount   int
+	Since    time.Time // when the oldest part of Amount still owed was lent
+	Due      time.Time // earliest due date of the parts still owed, zero if none
+}
+
+// Involves reports whether user is either side of the balance
+func (b Balance) Involves(user string) bool {
+	return b.Debtor == user || b.Creditor == user
+}
+
+// Overdue reports whether a part of the balance was due before today, a
+// date at midnight UTC like due dates
+func (b Balance) Overdue(today time.Time) bool {
+	return !b.Due.IsZero() && b.Due.Before(today)
+}
+
+// lot is a part of a balance lent at once
+type lot struct {
+	amount int
+	time   time.Time
+	due    time.Time
+}
+
+// account is what the first user of a pair owes the second, negative if
+// the second owes the first, split into lots that are paid back oldest first
+type account struct {
+	net  int
+	lots []lot
+}
+
+// add applies an amount the first user of the pair came to owe the second
+// by a due date, which may be zero
+func (a *account) add(amount int, at, due time.Time) {
+	if amount == 0 {
+		return
+	}
+	if a.net == 0 || (a.net > 0) == (amount > 0) {
+		a.net += amount
+		a.lots = append(a.lots, lot{amount: abs(amount), time: at, due: due})
+		return
+	}
+
+	a.net += amount
+	rest := abs(amount)
+	for rest > 0 && len(a.lots) > 0 {
+		if a.lots[0].amount > rest {
+			a.lots[0].amount -= rest
+			return
+		}
+		rest -= a.lots[0].amount
+		a.lots = a.lots[1:]
+	}
+	// Paying back more than was owed turns the rest into a debt the other way
+	if rest > 0 {
+		a.lots = []lot{{amount: rest, time: at, due: due}}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Balances returns the non-zero balances between every pair of users of a
+// chat ordered by debtor and creditor
+func (l *Ledger) Balances(chatID int64) ([]Balance, error) {
+	entries, err := l.store.Entries(chatID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct{ a, b string }
+	accounts := make(map[pair]*account)
+	for _, entry := range entries {
+		if entry.From == entry.To {
+			continue
+		}
+		p, amount := pair{entry.From, entry.To}, -entry.Amount
+		if entry.To < entry.From {
+			p, amount = pair{entry.To, entry.From}, entry.Amount
+		}
+		if accounts[p] == nil {
+			accounts[p] = &account{}
+		}
+		accounts[p].add(amount, entry.Time, entry.Due)
+	}
+
+	var balances []Balance
+	for p, acc := range accounts {
+		var balance Balance
+		switch {
+		case acc.net > 0:
+			balance = Balance{Debtor: p.a, Creditor: p.b, Amount: acc.net}
+		case acc.net < 0:
+			balance = Balance{Debtor: p.b, Creditor: p.a, Amount: -acc.net}
+		default:
+			continue
+		}
+		balance.Since = acc.lots[0].time
+		for _, lot := range acc.lots {
+			if !lot.due.IsZero() && (balance.Due.IsZero() || lot.due.Before(balance.Due)) {
+				balance.Due = lot.due
+			}
+		}
+		balances = append(balances, balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Debtor != balances[j].Debtor {
+			return balances[i].Debtor < balances[j].Debtor
+		}
+		return balances[i].Creditor < balances[j].Creditor
+	})
+	return balances, nil
+}
+
+// HistoryPage is a page of a chat's history, newest first
+type HistoryPage struct {
+	Entries []storage.Entry
+	Total   int // entries matching the filter on all pages
+	Page    int
+	Pages   int
+}
+
+// History returns the page of entries matching filter, clamped to the last
+// page, with times in loc
+func (l *Ledger) History(chatID int64, filter storage.HistoryFilter, loc *time.Location, page, pageSize int) (HistoryPage, error) {
+	entries, total, err := l.store.History(chatID, filter, page*pageSize, pageSize)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	pages := (total + pageSize - 1) / pageSize
+	if pages > 0 && page >= pages {
+		page = pages - 1
+		entries, total, err = l.store.History(chatID, filter, page*pageSize, pageSize)
+		if err != nil {
+			return HistoryPage{}, err
+		}
+	}
+	for i := range entries {
+		entries[i].Time = entries[i].Time.In(loc)
+	}
+	return HistoryPage{Entries: entries, Total: total, Page: page, Pages: pages}, nil
+}
+
+// Cancelled is an operation deleted by Cancel
+type Cancelled struct {
+	storage.Operation
+	Deleted int // number of deleted entries
+}
+
+// Cancel deletes the latest operation of a chat on behalf of user, who must
+// be its author unless admin is set, and returns what was deleted
+func (l *Ledger) Cancel(chatID int64, user string, admin bool) (Cancelled, error) {
+	op, err := l.store.LastOperation(chatID)
+	if err == storage.ErrNotFound {
+		return Cancelled{}, ErrNothingToCancel
+	}
+	if err != nil {
+		return Cancelled{}, err
+	}
+	if op.Author != user && !admin {
+		return Cancelled{}, &NotAuthorError{Author: op.Author}
+	}
+
+	deleted, err := l.store.CancelOperation(chatID, op.ID)
+	if err != nil {
+		return Cancelled{}, err
+	}
+	if deleted == 0 {
+		return Cancelled{}, ErrAlreadyCancelled
+	}
+	return Cancelled{Operation: op, Deleted: deleted}, nil
+}
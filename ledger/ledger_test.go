@@ -0,0 +1,278 @@
+package ledger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+const chatID = -100
+
+var base = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newLedger(t *testing.T) (*Ledger, storage.Store) {
+	t.Helper()
+	store := storage.OpenMemory()
+	t.Cleanup(func() { store.Close() })
+	return New(store), store
+}
+
+func record(t *testing.T, l *Ledger, split Split) Recorded {
+	t.Helper()
+	split.ChatID = chatID
+	if split.Time.IsZero() {
+		split.Time = base
+	}
+	recorded, err := l.RecordSplit(split)
+	if err != nil {
+		t.Fatalf("RecordSplit: %v", err)
+	}
+	return recorded
+}
+
+func TestRecordSplit(t *testing.T) {
+	due := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		before  []Split
+		split   Split
+		shares  []Share
+		entries []storage.Entry
+	}{
+		{
+			name:   "new debt",
+			split:  Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Reason: "обед", Due: due},
+			shares: []Share{{Debtor: "ivan", Owed: 500}},
+			entries: []storage.Entry{
+				{From: "anna", To: "ivan", Amount: 500, Reason: "обед", Type: storage.TypeDebt, Due: due},
+			},
+		},
+		{
+			name:   "pays back all",
+			before: []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 800}},
+			split:  Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500},
+			shares: []Share{{Debtor: "ivan", Returned: 500}},
+			entries: []storage.Entry{
+				{From: "anna", To: "ivan", Amount: 500, Type: storage.TypeReturn},
+			},
+		},
+		{
+			name:   "pays back part",
+			before: []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 200}},
+			split:  Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Reason: "кино", Due: due},
+			shares: []Share{{Debtor: "ivan", Returned: 200, Owed: 300}},
+			entries: []storage.Entry{
+				{From: "anna", To: "ivan", Amount: 200, Reason: "кино", Type: storage.TypeReturn},
+				{From: "anna", To: "ivan", Amount: 300, Reason: "кино", Type: storage.TypeDebt, Due: due},
+			},
+		},
+		{
+			name:   "debt the other way adds up",
+			before: []Split{{Payer: "anna", Debtors: []string{"ivan"}, Share: 200}},
+			split:  Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500},
+			shares: []Share{{Debtor: "ivan", Owed: 500}},
+			entries: []storage.Entry{
+				{From: "anna", To: "ivan", Amount: 500, Type: storage.TypeDebt},
+			},
+		},
+		{
+			name:   "payer is skipped",
+			before: []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 100}},
+			split:  Split{Payer: "anna", Debtors: []string{"anna", "ivan", "maria"}, Share: 300},
+			shares: []Share{{Debtor: "ivan", Returned: 100, Owed: 200}, {Debtor: "maria", Owed: 300}},
+			entries: []storage.Entry{
+				{From: "anna", To: "ivan", Amount: 100, Type: storage.TypeReturn},
+				{From: "anna", To: "ivan", Amount: 200, Type: storage.TypeDebt},
+				{From: "anna", To: "maria", Amount: 300, Type: storage.TypeDebt},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, store := newLedger(t)
+			for _, split := range test.before {
+				record(t, l, split)
+			}
+			recorded := record(t, l, test.split)
+			if !reflect.DeepEqual(recorded.Shares, test.shares) {
+				t.Errorf("Shares = %+v, want %+v", recorded.Shares, test.shares)
+			}
+
+			op, err := store.LastOperation(chatID)
+			if err != nil {
+				t.Fatalf("LastOperation: %v", err)
+			}
+			if op.ID != recorded.OperationID {
+				t.Errorf("last operation = %d, want %d", op.ID, recorded.OperationID)
+			}
+			var entries []storage.Entry
+			for _, entry := range op.Entries {
+				entries = append(entries, storage.Entry{From: entry.From, To: entry.To, Amount: entry.Amount,
+					Reason: entry.Reason, Type: entry.Type, Due: entry.Due})
+			}
+			if !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("entries = %+v, want %+v", entries, test.entries)
+			}
+		})
+	}
+}
+
+func TestRecordCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   []Split
+		split    Split
+		category string
+	}{
+		{"expense", nil, Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Reason: "обед"}, "кафе"},
+		{"expense netted against a debt", []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 800}},
+			Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Reason: "обед"}, "кафе"},
+		{"repayment", []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 800}},
+			Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500}, storage.RepaymentCategory},
+		{"loan", nil, Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500}, storage.DefaultCategory},
+		{"repayment and a loan", []Split{{Payer: "ivan", Debtors: []string{"anna"}, Share: 200}},
+			Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500}, storage.DefaultCategory},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, _ := newLedger(t)
+			for _, split := range test.before {
+				record(t, l, split)
+			}
+			if recorded := record(t, l, test.split); recorded.Category != test.category {
+				t.Errorf("Category = %q, want %q", recorded.Category, test.category)
+			}
+		})
+	}
+}
+
+func TestRecordNothing(t *testing.T) {
+	l, store := newLedger(t)
+	recorded := record(t, l, Split{Payer: "anna", Debtors: []string{"anna"}, Share: 500})
+	if recorded.OperationID != 0 {
+		t.Errorf("OperationID = %d, want nothing recorded", recorded.OperationID)
+	}
+	if _, err := store.LastOperation(chatID); err != storage.ErrNotFound {
+		t.Errorf("LastOperation = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBalances(t *testing.T) {
+	due := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	later := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		splits []Split
+		want   []Balance
+	}{
+		{
+			name: "nets both ways",
+			splits: []Split{
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 500},
+				{Payer: "ivan", Debtors: []string{"anna"}, Share: 200, Time: base.Add(time.Hour)},
+			},
+			want: []Balance{{Debtor: "ivan", Creditor: "anna", Amount: 300, Since: base}},
+		},
+		{
+			name: "settled",
+			splits: []Split{
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 500},
+				{Payer: "ivan", Debtors: []string{"anna"}, Share: 500, Time: base.Add(time.Hour)},
+			},
+		},
+		{
+			name: "returns pay back the oldest debt first",
+			splits: []Split{
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Due: due},
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 300, Time: base.Add(time.Hour), Due: later},
+				{Payer: "ivan", Debtors: []string{"anna"}, Share: 600, Time: base.Add(2 * time.Hour)},
+			},
+			want: []Balance{{Debtor: "ivan", Creditor: "anna", Amount: 200, Since: base.Add(time.Hour), Due: later}},
+		},
+		{
+			name: "earliest due date still owed",
+			splits: []Split{
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Due: later},
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 300, Time: base.Add(time.Hour), Due: due},
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 100, Time: base.Add(2 * time.Hour)},
+			},
+			want: []Balance{{Debtor: "ivan", Creditor: "anna", Amount: 900, Since: base, Due: due}},
+		},
+		{
+			name: "paying back too much turns the debt around",
+			splits: []Split{
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 500, Due: due},
+				{Payer: "ivan", Debtors: []string{"anna"}, Share: 800, Time: base.Add(time.Hour), Due: later},
+			},
+			want: []Balance{{Debtor: "anna", Creditor: "ivan", Amount: 300, Since: base.Add(time.Hour), Due: later}},
+		},
+		{
+			name: "ordered by debtor and creditor",
+			splits: []Split{
+				{Payer: "maria", Debtors: []string{"ivan", "anna"}, Share: 100},
+				{Payer: "anna", Debtors: []string{"ivan"}, Share: 200},
+			},
+			want: []Balance{
+				{Debtor: "anna", Creditor: "maria", Amount: 100, Since: base},
+				{Debtor: "ivan", Creditor: "anna", Amount: 200, Since: base},
+				{Debtor: "ivan", Creditor: "maria", Amount: 100, Since: base},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, _ := newLedger(t)
+			for _, split := range test.splits {
+				record(t, l, split)
+			}
+			balances, err := l.Balances(chatID)
+			if err != nil {
+				t.Fatalf("Balances: %v", err)
+			}
+			for i := range balances {
+				balances[i].Since = balances[i].Since.UTC()
+			}
+			if !reflect.DeepEqual(balances, test.want) {
+				t.Errorf("Balances = %+v, want %+v", balances, test.want)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	l, _ := newLedger(t)
+	if _, err := l.Cancel(chatID, "anna", false); err != ErrNothingToCancel {
+		t.Errorf("Cancel with no operations = %v, want ErrNothingToCancel", err)
+	}
+
+	first := record(t, l, Split{Payer: "anna", Debtors: []string{"ivan"}, Share: 500})
+	second := record(t, l, Split{Payer: "ivan", Debtors: []string{"anna", "maria"}, Share: 100})
+
+	_, err := l.Cancel(chatID, "anna", false)
+	var notAuthor *NotAuthorError
+	if !errors.As(err, &notAuthor) || notAuthor.Author != "ivan" {
+		t.Fatalf("Cancel by another user = %v, want NotAuthorError by ivan", err)
+	}
+
+	cancelled, err := l.Cancel(chatID, "ivan", false)
+	if err != nil {
+		t.Fatalf("Cancel by the author: %v", err)
+	}
+	if cancelled.ID != second.OperationID || cancelled.Deleted != 2 {
+		t.Errorf("Cancel by the author = operation %d, %d entries; want %d, 2", cancelled.ID, cancelled.Deleted, second.OperationID)
+	}
+
+	cancelled, err = l.Cancel(chatID, "maria", true)
+	if err != nil {
+		t.Fatalf("Cancel by an admin: %v", err)
+	}
+	if cancelled.ID != first.OperationID || cancelled.Author != "anna" {
+		t.Errorf("Cancel by an admin = operation %d by %s; want %d by anna", cancelled.ID, cancelled.Author, first.OperationID)
+	}
+	if _, err := l.Cancel(chatID, "anna", false); err != ErrNothingToCancel {
+		t.Errorf("Cancel after everything = %v, want ErrNothingToCancel", err)
+	}
+}
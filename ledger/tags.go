@@ -0,0 +1,99 @@
+package ledger
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"obshyakBot3/storage"
+)
+
+// defaultCategory is used for operations whose reason matches no known category
+const defaultCategory = storage.DefaultCategory
+
+var hashtagRe = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// categoryKeywords lists the words in a reason that suggest a category. The
+// category name itself always matches as well. Categories are tried in
+// order, so a word listed under several goes to the first.
+var categoryKeywords = []struct {
+	Category string
+	Keywords []string
+}{
+	{"продукты", []string{"магнит", "пятерочка", "пятёрочка", "перекресток", "перекрёсток", "ашан", "лента", "вкусвилл", "дикси", "продукты", "еда"}},
+	{"кафе", []string{"обед", "ужин", "завтрак", "кафе", "ресторан", "кофе", "пицца", "суши", "шаурма", "доставка"}},
+	{"транспорт", []string{"такси", "бензин", "метро", "электричка", "поезд", "самолет", "самолёт", "каршеринг", "парковка"}},
+	{"жилье", []string{"аренда", "квартплата", "коммуналка", "жкх", "интернет", "электричество", "свет"}},
+	{"развлечения", []string{"кино", "бар", "концерт", "вечеринка", "театр", "музей", "боулинг", "караоке", "билеты"}},
+	{"подписки", []string{"подписка", "netflix", "spotify", "кинопоиск", "яндекс плюс"}},
+}
+
+// extractTags returns the normalized, de-duplicated #hashtags found in a reason
+func extractTags(reason string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagRe.FindAllStringSubmatch(reason, -1) {
+		tag := NormalizeTag(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// NormalizeTag lowercases a tag and folds ё into е so that #Ёлка and #елка match
+func NormalizeTag(tag string) string {
+	return strings.ReplaceAll(strings.ToLower(tag), "ё", "е")
+}
+
+// suggestCategory picks a category for an operation. Tags naming a known
+// category win, then keywords in the reason, then the first tag, and finally
+// the default category.
+func suggestCategory(reason string, tags []string) string {
+	for _, tag := range tags {
+		if category := categoryForWord(tag); category != "" {
+			return category
+		}
+	}
+
+	lowered := NormalizeTag(reason)
+	for _, word := range strings.FieldsFunc(lowered, isWordSeparator) {
+		if category := categoryForWord(word); category != "" {
+			return category
+		}
+	}
+	// Multi-word keywords such as "яндекс плюс" are not split into fields
+	for _, category := range categoryKeywords {
+		for _, keyword := range category.Keywords {
+			if strings.Contains(keyword, " ") && strings.Contains(lowered, keyword) {
+				return category.Category
+			}
+		}
+	}
+
+	if len(tags) > 0 {
+		return tags[0]
+	}
+	return defaultCategory
+}
+
+// categoryForWord returns the known category a single word belongs to, if any
+func categoryForWord(word string) string {
+	word = NormalizeTag(word)
+	for _, category := range categoryKeywords {
+		if word == NormalizeTag(category.Category) {
+			return category.Category
+		}
+		for _, keyword := range category.Keywords {
+			if word == NormalizeTag(keyword) {
+				return category.Category
+			}
+		}
+	}
+	return ""
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
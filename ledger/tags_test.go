@@ -0,0 +1,72 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   []string
+	}{
+		{"обед", nil},
+		{"обед #кафе", []string{"кафе"}},
+		{"#Ёлка и #елка", []string{"елка"}},
+		{"#отпуск_2024, #Море!", []string{"отпуск_2024", "море"}},
+		{"# пусто", nil},
+	}
+	for _, test := range tests {
+		if got := extractTags(test.reason); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("extractTags(%q) = %q, want %q", test.reason, got, test.want)
+		}
+	}
+}
+
+func TestSuggestCategory(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"", defaultCategory},
+		{"подарок", defaultCategory},
+		{"обед в столовой", "кафе"},
+		{"Пятёрочка", "продукты"},
+		{"такси домой", "транспорт"},
+		{"яндекс плюс на год", "подписки"},
+		{"обед #отпуск", "кафе"},
+		{"обед #такси", "транспорт"},
+		{"подарок #др", "др"},
+		{"подарок #ДР #кино", "развлечения"},
+		// "еда" belongs to продукты and "доставка" to кафе; the first keyword in the reason wins
+		{"еда доставка", "продукты"},
+		{"доставка еда", "кафе"},
+	}
+	for _, test := range tests {
+		if got := suggestCategory(test.reason, extractTags(test.reason)); got != test.want {
+			t.Errorf("suggestCategory(%q) = %q, want %q", test.reason, got, test.want)
+		}
+	}
+}
+
+func TestCategoryForWordIsDeterministic(t *testing.T) {
+	saved := categoryKeywords
+	t.Cleanup(func() { categoryKeywords = saved })
+	categoryKeywords = append(categoryKeywords[:0:0], saved...)
+	categoryKeywords = append(categoryKeywords, struct {
+		Category string
+		Keywords []string
+	}{"здоровье", []string{"аптека", "обед"}})
+
+	for i := 0; i < 100; i++ {
+		if got := categoryForWord("обед"); got != "кафе" {
+			t.Fatalf("categoryForWord(обед) = %q, want the first category listing it", got)
+		}
+	}
+	if got := categoryForWord("Аптека"); got != "здоровье" {
+		t.Errorf("categoryForWord(Аптека) = %q, want здоровье", got)
+	}
+	if got := categoryForWord("подарок"); got != "" {
+		t.Errorf("categoryForWord(подарок) = %q, want none", got)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "log"
+
+// logLevel is the importance of a log message. Errors are always logged with
+// log.Printf; logf is for the messages that may be silenced with log_level.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]logLevel{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// logf logs a message if its level is enabled by the configuration
+func logf(level logLevel, format string, args ...interface{}) {
+	if level >= logLevels[cfg.LogLevel] {
+		log.Printf(format, args...)
+	}
+}
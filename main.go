@@ -1,727 +1,651 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/joho/godotenv"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
 )
 
-// Debt represents a debt between two users
-type Debt struct {
-	From    string
-	To      string
-	Amount  int
-	Reason  string
-	ChatID  int64
-	Time    time.Time
-}
+var store storage.Store
 
-var db *sql.DB
+// chatLedger applies the ledger rules on top of store
+var chatLedger *ledger.Ledger
 
-func initDB() {
-	var err error
-	db, err = sql.Open("sqlite3", "./debts.db")
-	if err != nil {
-		log.Fatal(err)
+var inMemory = flag.Bool("memory", false, "keep the ledger in memory only, for tests and demo runs")
+
+// Flags overriding the configuration file and the environment
+var (
+	configPath   = flag.String("config", defaultConfigPath, "YAML configuration file, see config.example.yaml")
+	database     = flag.String("database", defaultConfig().Database, "database URL")
+	debug        = flag.Bool("debug", false, "log every Bot API request")
+	logLevelName = flag.String("log-level", defaultConfig().LogLevel, "debug, info, warn or error")
+	workers      = flag.Int("workers", defaultConfig().Workers, "number of chats handled in parallel")
+	queueSize    = flag.Int("queue-size", defaultConfig().QueueSize, "updates waiting per worker before reading new ones pauses")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", defaultConfig().ShutdownTimeout, "how long to finish queued updates on SIGINT or SIGTERM")
+)
+
+// setupConfig loads .env, the config file and the flags given on the command
+// line into cfg and validates the result
+func setupConfig() error {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(".env: %w", err)
 	}
 
-	// Create debts table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS debts (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			from_user TEXT NOT NULL,
-			to_user TEXT NOT NULL,
-			amount INTEGER NOT NULL,
-			reason TEXT,
-			chat_id INTEGER NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			operation_type TEXT DEFAULT 'debt',
-			operation_id INTEGER DEFAULT 1
-		)
-	`)
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	c, err := loadConfig(*configPath, explicit["config"])
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if explicit["database"] {
+		c.Database = *database
 	}
+	if *inMemory {
+		c.Database = storage.MemoryURL
+	}
+	if explicit["debug"] {
+		c.Debug = *debug
+	}
+	if explicit["log-level"] {
+		c.LogLevel = *logLevelName
+	}
+	if explicit["workers"] {
+		c.Workers = *workers
+	}
+	if explicit["queue-size"] {
+		c.QueueSize = *queueSize
+	}
+	if explicit["shutdown-timeout"] {
+		c.ShutdownTimeout = *shutdownTimeout
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+	cfg = c
+	return nil
 }
 
-// getNextOperationID returns the next available operation ID
-func getNextOperationID() (int, error) {
-	var maxID int
-	err := db.QueryRow(`SELECT COALESCE(MAX(operation_id), 0) FROM debts`).Scan(&maxID)
+// openStore connects to the configured database and brings its schema up to date
+func openStore(dryRun bool) {
+	var err error
+	store, err = storage.Open(cfg.Database)
 	if err != nil {
-		return 0, err
+		log.Fatal(err)
+	}
+
+	if err := store.Migrate(dryRun); err != nil {
+		log.Fatal(err)
+	}
+	if !dryRun {
+		if err := importLegacyWomen(); err != nil {
+			log.Fatal(err)
+		}
 	}
-	return maxID + 1, nil
+	chatLedger = ledger.New(store)
 }
 
 func main() {
-	// Get bot token from environment variable
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN environment variable is not set")
+	migrateOnly := flag.Bool("migrate-only", false, "apply pending database migrations and exit")
+	dryRun := flag.Bool("dry-run", false, "with -migrate-only, check pending migrations without applying them")
+	record := flag.String("record", "", "append every incoming update to this JSON lines file for replay")
+	flag.Parse()
+	if err := setupConfig(); err != nil {
+		log.Fatal(err)
+	}
+	checkCatalogs()
+	if flag.Arg(0) == "replay" {
+		os.Exit(runReplay(flag.Args()[1:]))
+	}
+
+	if *migrateOnly {
+		openStore(*dryRun)
+		store.Close()
+		return
 	}
 
-	isWoman := make(map[string]bool)
-	for _, name := range strings.Split(os.Getenv("SKIBIDI_WOMEN"), ",") {
-		isWoman[name] = true
+	if cfg.Token == "" {
+		log.Fatal("Bot token is not set: use token in the config file or TELEGRAM_BOT_TOKEN")
 	}
 
 	// Initialize database
-	initDB()
-	defer db.Close()
+	openStore(false)
+	defer store.Close()
 
-	// Create bot instance
-	bot, err := tgbotapi.NewBotAPI(token)
+	// Create bot instance, optionally against another Bot API server
+	endpoint := cfg.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.Token, endpoint)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	bot.Debug = true
+	bot.Debug = cfg.Debug
 
-	log.Printf("Authorized on account %s", bot.Self.UserName)
+	logf(levelInfo, "Authorized on account %s", bot.Self.UserName)
+	client := newBotClient(bot, endpoint)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	var rec *recorder
+	if *record != "" {
+		rec, err = openRecorder(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rec.Close()
+	}
 
-	updates := bot.GetUpdatesChan(u)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	for update := range updates {
-		if update.Message == nil {
-			continue
+	// Receive updates from a webhook if one is configured, by long polling otherwise
+	var receive receiver
+	if cfg.Webhook.Listen != "" {
+		updates, server, err := listenForWebhook(bot, cfg.Webhook)
+		if err != nil {
+			log.Fatal(err)
+		}
+		receive = func(*dispatcher) (tgbotapi.UpdatesChannel, func()) {
+			return updates, func() {
+				// Let the requests in progress hand over their updates
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+				defer cancel()
+				if err := server.Shutdown(shutdownCtx); err != nil {
+					log.Printf("Error stopping webhook server: %v", err)
+				}
+			}
 		}
+	} else {
+		receive = func(pool *dispatcher) (tgbotapi.UpdatesChannel, func()) {
+			return pollUpdates(client, pool)
+		}
+	}
+
+	offset := serve(ctx, client, receive, rec)
+
+	if cfg.Webhook.Listen == "" {
+		// Confirm the handled updates, so they are not delivered again after a
+		// restart. Updates received but not handled stay unconfirmed.
+		confirmUpdates(client, offset)
+	}
+	logf(levelInfo, "Stopped, next update is %d", offset)
+}
+
+// receiver starts receiving updates for pool. It returns the channel they
+// arrive on and a function that stops receiving, after which only the updates
+// already in the channel are left.
+type receiver func(pool *dispatcher) (tgbotapi.UpdatesChannel, func())
+
+// serve answers the updates from receive on a pool of workers, recording them
+// if rec is not nil, and runs the scheduled jobs on the same workers. When ctx
+// is cancelled it stops receiving and scheduling jobs, hands the updates
+// already received to the workers and waits for them up to the shutdown timeout.
+// It returns the ID of the first update that was not handled.
+func serve(ctx context.Context, bot telegramClient, receive receiver, rec *recorder) int {
+	if rec != nil {
+		bot = recordingClient{telegramClient: bot, recorder: rec}
+	}
 
-		// Check if the message is from a group chat
-		if update.Message.Chat.Type == "private" {
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Этот бот работает только в групповых чатах. Пожалуйста, добавьте меня в групповой чат!")
-			bot.Send(msg)
-			continue
+	pool := newDispatcher(cfg.Workers, cfg.QueueSize, func(update tgbotapi.Update) {
+		handleUpdate(bot, update)
+	})
+	updates, stopReceiving := receive(pool)
+
+	// The schedulers queue jobs on the pool, so they stop before it closes
+	scheduleCtx, stopScheduling := context.WithCancel(ctx)
+	var schedulers sync.WaitGroup
+	schedulers.Add(2)
+	go func() {
+		defer schedulers.Done()
+		runDigests(scheduleCtx, bot, pool)
+	}()
+	go func() {
+		defer schedulers.Done()
+		runScheduler(scheduleCtx, bot, pool)
+	}()
+	dispatch := func(update tgbotapi.Update) {
+		if rec != nil {
+			if err := rec.recordUpdate(update); err != nil {
+				log.Printf("Error recording update: %v", err)
+			}
 		}
+		pool.dispatch(update)
+	}
 
-		// Handle commands
-		if update.Message.IsCommand() {
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
-			
-			switch update.Message.Command() {
-			case "help":
-				msg.Text = `Как пользоваться ботом:
-
-1. Запись долга:
-   • @username сумма [причина] - записать долг для одного человека
-   • @user1 @user2 сумма [причина] - разделить сумму между несколькими людьми
-   • @all сумма [причина] - разделить сумму между всеми участниками чата
-   • /each @username1 [@username2 ...] сумма [причина] - дать сумму в долг каждому из указанных пользователей
-
-2. Команды:
-   • /balance - показать все долги в чате
-   • /balance me - показать ваши личные долги
-   • /history [дней] - показать историю операций (по умолчанию за 1 день)
-   • /cancel - отменить последнюю операцию
-   • /help - показать это сообщение
-
-Примеры:
-• @ivan 50 обед
-• @ivan @maria 100 ужин
-• @all 150 вечеринка
-• /history 30 - показать историю за 30 дней`
-			case "balance":
-				// Calculate and show net balances
-				chatDebts := getChatDebts(update.Message.Chat.ID)
-				if len(chatDebts) == 0 {
-					msg.Text = "В этом чате пока нет записанных долгов."
-				} else {
-					// Create a map to store net balances between users
-					balances := make(map[string]map[string]int)
-					
-					// Calculate all debts
-					for _, debt := range chatDebts {
-						// Initialize maps if they don't exist
-						if _, exists := balances[debt.From]; !exists {
-							balances[debt.From] = make(map[string]int)
-						}
-						if _, exists := balances[debt.To]; !exists {
-							balances[debt.To] = make(map[string]int)
-						}
-						
-						// Add the debt (To owes From)
-						balances[debt.To][debt.From] += debt.Amount
-						balances[debt.From][debt.To] -= debt.Amount
-					}
-					
-					// Build the response
-					var response strings.Builder
-					
-					// Check if this is a personal balance request
-					args := update.Message.CommandArguments()
-					isPersonal := args == "me"
-					
-					if isPersonal {
-						response.WriteString("Ваши долги:\n\n")
-						author := update.Message.From.UserName
-						
-						// Track which pairs we've already processed
-						processed := make(map[string]bool)
-						hasDebts := false
-						
-						// Show non-zero balances involving the author
-						for user1, debts := range balances {
-							for user2, amount := range debts {
-								// Skip if we've already processed this pair or if it's the same user
-								pairKey := fmt.Sprintf("%s-%s", user1, user2)
-								reversePairKey := fmt.Sprintf("%s-%s", user2, user1)
-								if processed[pairKey] || processed[reversePairKey] || user1 == user2 {
-									continue
-								}
-								
-								// Only show balances involving the author
-								if (user1 == author || user2 == author) && amount != 0 {
-									hasDebts = true
-									owes := "должен"
-									if amount > 0 {
-										if (isWoman[user1]) {
-											owes = "должна"
-										}
-										response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", user1, owes, user2, amount/100, amount%100))
-									} else {
-										if (isWoman[user2]) {
-											owes = "должна"
-										}
-										response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", user2, owes, user1, (-amount)/100, (-amount)%100))
-									}
-								}
-								
-								processed[pairKey] = true
-								processed[reversePairKey] = true
-							}
-						}
-						
-						if !hasDebts {
-							response.WriteString("У вас нет непогашенных долгов.")
-						}
-					} else {
-						response.WriteString("Долги в этом чате:\n\n")
-						
-						// Track which pairs we've already processed
-						processed := make(map[string]bool)
-						
-						// Show non-zero balances
-						for user1, debts := range balances {
-							for user2, amount := range debts {
-								// Skip if we've already processed this pair or if it's the same user
-								pairKey := fmt.Sprintf("%s-%s", user1, user2)
-								reversePairKey := fmt.Sprintf("%s-%s", user2, user1)
-								if processed[pairKey] || processed[reversePairKey] || user1 == user2 {
-									continue
-								}
-								
-								// Only show non-zero balances
-								if amount != 0 {
-									owes := "должен"
-									if amount > 0 {
-										if (isWoman[user1]) {
-											owes = "должна"
-										}
-										response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", user1, owes, user2, amount/100, amount%100))
-									} else {
-										if (isWoman[user2]) {
-											owes = "должна"
-										}
-										response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", user2, owes, user1, (-amount)/100, (-amount)%100))
-									}
-								}
-								
-								processed[pairKey] = true
-								processed[reversePairKey] = true
-							}
-						}
-						
-						if response.Len() == len("Долги в этом чате:\n\n") {
-							response.WriteString("Нет непогашенных долгов.")
-						}
-					}
-					
-					msg.Text = response.String()
-				}
-			case "history":
-				// Get number of days from command arguments
-				args := update.Message.CommandArguments()
-				days := 1 // Default to 1 day if no argument provided
-				if args != "" {
-					if d, err := strconv.Atoi(args); err == nil && d > 0 {
-						days = d
+receive:
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				break receive
+			}
+			dispatch(update)
+		case <-ctx.Done():
+			logf(levelInfo, "Shutting down, finishing received updates")
+			stopReceiving()
+		drain:
+			for {
+				select {
+				case update, ok := <-updates:
+					if !ok {
+						break drain
 					}
+					dispatch(update)
+				default:
+					break drain
 				}
+			}
+			break receive
+		}
+	}
 
-				// Get history for the specified period
-				history, err := getDebtHistory(update.Message.Chat.ID, days)
-				if err != nil {
-					msg.Text = "Ошибка при получении истории. Пожалуйста, попробуйте снова."
-					bot.Send(msg)
-					continue
-				}
+	stopScheduling()
+	schedulers.Wait()
+	if !pool.closeWithin(cfg.ShutdownTimeout) {
+		logf(levelWarn, "Updates still in progress after %v, giving up", cfg.ShutdownTimeout)
+	}
+	return pool.offset()
+}
 
-				if len(history) == 0 {
-					msg.Text = fmt.Sprintf("Нет операций за последние %d дней.", days)
-				} else {
-					var response strings.Builder
-					response.WriteString(fmt.Sprintf("История операций за последние %d дней:\n\n", days))
-					
-					for _, debt := range history {
-						// Get operation type for this debt
-						var operationType string
-						err := db.QueryRow(`
-							SELECT operation_type 
-							FROM debts 
-							WHERE chat_id = ? AND from_user = ? AND to_user = ? AND amount = ? AND created_at = ?
-						`, debt.ChatID, debt.From, debt.To, debt.Amount, debt.Time.Format("2006-01-02 15:04:05")).Scan(&operationType)
-						if err != nil {
-							log.Printf("Error getting operation type: %v", err)
-							operationType = "debt" // Default to debt if there's an error
-						}
-
-						response.WriteString(fmt.Sprintf("[%s] ", debt.Time.Format("02.01.2006 15:04")))
-						
-						if operationType == "return" {
-							returnedVerb := "вернул"
-							if (isWoman[debt.From]) {
-								returnedVerb = "вернула"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d", debt.From, returnedVerb, debt.To, debt.Amount/100, debt.Amount%100))
-						} else {
-							owes := "должен"
-							if (isWoman[debt.To]) {
-								owes = "должна"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s s %d.%02d", debt.To, owes, debt.From, debt.Amount/100, debt.Amount%100))
-						}
-						
-						if debt.Reason != "" {
-							response.WriteString(fmt.Sprintf(" %s", debt.Reason))
-						}
-						response.WriteString("\n")
-					}
-					msg.Text = response.String()
-				}
-			case "cancel":
-				// Find the latest operation ID and the user who performed it
-				var latestOperationID int
-				var latestOperationUser string
-				err := db.QueryRow(`
-					SELECT operation_id, from_user 
-					FROM debts 
-					WHERE chat_id = ? 
-					ORDER BY operation_id DESC, created_at DESC 
-					LIMIT 1
-				`, update.Message.Chat.ID).Scan(&latestOperationID, &latestOperationUser)
-				if err != nil {
-					msg.Text = "Ошибка при поиске последней операции. Пожалуйста, попробуйте снова."
-					bot.Send(msg)
-					continue
-				}
+// handleUpdate answers a single incoming update
+func handleUpdate(bot telegramClient, update tgbotapi.Update) {
+	if chat := update.FromChat(); chat != nil && !cfg.chatAllowed(chat.ID, chat.IsPrivate()) {
+		logf(levelDebug, "Ignoring update from chat %d, which is not allowed", chat.ID)
+		return
+	}
 
-				if latestOperationID == 0 {
-					msg.Text = "В этом чате нет операций для отмены."
-					bot.Send(msg)
-					continue
-				}
+	if update.CallbackQuery != nil {
+		if strings.HasPrefix(update.CallbackQuery.Data, historyCallbackPrefix) {
+			handleHistoryCallback(bot, update.CallbackQuery)
+		}
+		return
+	}
 
-				// Check if the current user is the one who performed the operation
-				currentUser := update.Message.From.UserName
-				if currentUser != latestOperationUser {
-					msg.Text = fmt.Sprintf("Вы не можете отменить эту операцию. Операция была выполнена пользователем %s.", latestOperationUser)
-					bot.Send(msg)
-					continue
-				}
+	if update.Message == nil {
+		return
+	}
+	lang := getChatLang(update.Message.Chat.ID)
+	rememberMessage(update.Message)
 
-				// Get the operations that will be cancelled for the response message
-				rows, err := db.Query(`
-					SELECT from_user, to_user, amount, reason, operation_type 
-					FROM debts 
-					WHERE chat_id = ? AND operation_id = ?
-					ORDER BY created_at
-				`, update.Message.Chat.ID, latestOperationID)
-				if err != nil {
-					msg.Text = "Ошибка при получении информации об операции. Пожалуйста, попробуйте снова."
-					bot.Send(msg)
-					continue
-				}
-				defer rows.Close()
-
-				var cancelledOperations []string
-				for rows.Next() {
-					var fromUser, toUser, reason, operationType string
-					var amount int
-					err := rows.Scan(&fromUser, &toUser, &amount, &reason, &operationType)
-					if err != nil {
-						log.Printf("Error scanning cancelled operation: %v", err)
-						continue
-					}
+	// Private chats only show the user's own balances
+	if update.Message.Chat.Type == "private" {
+		handlePrivateMessage(bot, update.Message, lang)
+		return
+	}
 
-					var operationDesc string
-					if operationType == "return" {
-						returnedVerb := "вернул"
-						if (isWoman[fromUser]) {
-							returnedVerb = "вернула"
-						}
-						operationDesc = fmt.Sprintf("%s %s %s %d.%02d", fromUser, returnedVerb, toUser, amount/100, amount%100)
-					} else {
-						owes := "должен"
-						if (isWoman[toUser]) {
-							owes = "должна"
-						}
-						operationDesc = fmt.Sprintf("%s %s %s %d.%02d", toUser, owes, fromUser, amount/100, amount%100)
-					}
-					if reason != "" {
-						operationDesc += fmt.Sprintf(" %s", reason)
+	// Handle uploaded ledgers for /import
+	if isImportUpload(update.Message) {
+		handleImportUpload(bot, update.Message)
+		return
+	}
+
+	// Handle commands
+	if update.Message.IsCommand() {
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
+		
+		switch update.Message.Command() {
+		case "help":
+			msg.Text = renderHelp(lang)
+		case "balance":
+			// Show net balances, only the author's with "me"
+			balances, err := chatLedger.Balances(update.Message.Chat.ID)
+			if err != nil {
+				log.Printf("Error calculating balances: %v", err)
+				msg.Text = lang.T("error.balance")
+				break
+			}
+
+			today := dateOf(clock().In(getChatLocation(update.Message.Chat.ID)))
+			var response strings.Builder
+			if update.Message.CommandArguments() == "me" {
+				author := update.Message.From.UserName
+				response.WriteString(lang.T("balance.mine") + "\n\n")
+				hasDebts := false
+				for _, balance := range balances {
+					if balance.Involves(author) {
+						hasDebts = true
+						response.WriteString(withDueDate(lang, describeBalance(lang, balance), balance, today) + "\n")
 					}
-					cancelledOperations = append(cancelledOperations, operationDesc)
 				}
-
-				// Delete all operations with the latest operation ID
-				result, err := db.Exec(`DELETE FROM debts WHERE chat_id = ? AND operation_id = ?`, update.Message.Chat.ID, latestOperationID)
-				if err != nil {
-					msg.Text = "Ошибка при отмене операции. Пожалуйста, попробуйте снова."
-					bot.Send(msg)
-					continue
+				if !hasDebts {
+					response.WriteString(lang.T("balance.mine.none"))
 				}
-
-				rowsAffected, err := result.RowsAffected()
-				if err != nil {
-					log.Printf("Error getting rows affected: %v", err)
+			} else {
+				response.WriteString(lang.T("balance.chat") + "\n\n")
+				for _, balance := range balances {
+					response.WriteString(withDueDate(lang, describeBalance(lang, balance), balance, today) + "\n")
 				}
-
-				if rowsAffected == 0 {
-					msg.Text = "Операция не найдена или уже была отменена."
-				} else {
-					var response strings.Builder
-					response.WriteString(fmt.Sprintf("Отменена последняя операция (ID: %d):\n\n", latestOperationID))
-					for _, operation := range cancelledOperations {
-						response.WriteString(fmt.Sprintf("• %s\n", operation))
-					}
-					response.WriteString(fmt.Sprintf("\nУдалено записей: %d", rowsAffected))
-					msg.Text = response.String()
+				if len(balances) == 0 {
+					response.WriteString(lang.T("balance.none"))
 				}
-			case "each":
-				// /each @username1 [@username2 ...] amount [reason]
-				args := update.Message.CommandArguments()
-				// Regex: one or more @username, then amount, then optional reason
-				// Example: /each @ivan @maria 100 ужин
-				//          /each @ivan 50
-				//          /each @ivan @maria 100
-				//          /each @ivan 100 обед
-				//          /each @ivan @maria 100
-				//          /each @ivan @maria 100.50 ужин
-				//          /each @ivan 100.50
-				//          /each @ivan @maria 100.50
-				//          /each @ivan @maria 100.50 reason with spaces
-				// Regex: ((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?
-				multiRe := regexp.MustCompile(`((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?`)
-				multiMatches := multiRe.FindStringSubmatch(args)
-				if multiMatches == nil {
-					msg.Text = "Использование: /each @username1 [@username2 ...] сумма [причина]"
-					bot.Send(msg)
-					continue
+			}
+			msg.Text = response.String()
+		case "history":
+			filter, err := parseHistoryFilter(update.Message.CommandArguments())
+			if err != nil {
+				msg.Text = lang.T("history.usage")
+				break
+			}
+			text, markup := renderHistoryPage(update.Message.Chat.ID, filter, 0)
+			msg.Text = text
+			if markup != nil {
+				msg.ReplyToMessageID = update.Message.MessageID
+				msg.ReplyMarkup = *markup
+			}
+		case "cancel":
+			// Only the author of the latest operation or a bot admin may cancel it
+			user := update.Message.From.UserName
+			cancelled, err := chatLedger.Cancel(update.Message.Chat.ID, user, cfg.isAdmin(user))
+			var notAuthor *ledger.NotAuthorError
+			switch {
+			case err == ledger.ErrNothingToCancel:
+				msg.Text = lang.T("cancel.nothing")
+			case errors.As(err, &notAuthor):
+				msg.Text = lang.T("cancel.not_author", notAuthor.Author)
+			case err == ledger.ErrAlreadyCancelled:
+				msg.Text = lang.T("cancel.gone")
+			case err != nil:
+				log.Printf("Error cancelling operation: %v", err)
+				msg.Text = lang.T("error.cancel")
+			default:
+				var response strings.Builder
+				response.WriteString(lang.T("cancel.done", cancelled.ID) + "\n\n")
+				for _, entry := range cancelled.Entries {
+					response.WriteString(fmt.Sprintf("• %s\n", describeEntry(lang, entry)))
 				}
-
-				usernames := regexp.MustCompile(`@(\w+)`).FindAllStringSubmatch(multiMatches[1], -1)
-				if len(usernames) == 0 {
-					msg.Text = "Не указаны пользователи. Использование: /each @username1 [@username2 ...] сумма [причина]"
-					bot.Send(msg)
-					continue
+				response.WriteString("\n" + lang.N("cancel.deleted", cancelled.Deleted, cancelled.Deleted))
+				msg.Text = response.String()
+				notifyCancelled(bot, update.Message.Chat, user, cancelled)
+			}
+		case "stats":
+			args := strings.Fields(update.Message.CommandArguments())
+			isCategories := len(args) > 0 && args[0] == "categories"
+			if isCategories {
+				args = args[1:]
+			}
+			days := 30 // Default to 30 days if no period provided
+			if len(args) > 0 {
+				d, err := strconv.Atoi(args[0])
+				if err != nil || d <= 0 {
+					msg.Text = lang.T("stats.usage")
+					break
 				}
+				days = d
+			}
 
-				amount := parseMoney(multiMatches[2])
-				reason := ""
-				if len(multiMatches) > 3 {
-					reason = multiMatches[3]
-				}
+			loc := getChatLocation(update.Message.Chat.ID)
+			since := periodStart(loc, days)
 
-				from := update.Message.From.UserName
-				operationID, err := getNextOperationID()
+			if isCategories {
+				totals, err := store.CategoryTotals(update.Message.Chat.ID, since)
 				if err != nil {
-					log.Printf("Error generating operation ID: %v", err)
-					msg.Text = "Ошибка при обработке операции. Пожалуйста, попробуйте снова."
-					bot.Send(msg)
-					continue
+					log.Printf("Error getting category totals: %v", err)
+					msg.Text = lang.T("error.stats")
+					break
+				}
+				if len(totals) == 0 {
+					msg.Text = lang.T("stats.empty", describePeriod(lang, days))
+					break
 				}
 
 				var response strings.Builder
-				response.WriteString(fmt.Sprintf("Добавлены долги по %d.%02d для %d пользователей:\n", amount/100, amount%100, len(usernames)))
-
-				for _, username := range usernames {
-					if username[1] == from {
-						continue // skip self
-					}
-					netBalance, err := getNetBalance(update.Message.Chat.ID, from, username[1])
-					if err != nil {
-						log.Printf("Error getting net balance: %v", err)
-						continue
-					}
-
-					if netBalance < 0 {
-						// This is a return operation
-						returnAmount := -netBalance
-						if amount <= returnAmount {
-							debt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: amount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(debt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							if isWoman[from] {
-								returnedVerb = "вернула"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", from, returnedVerb, username[1], amount/100, amount%100))
-						} else {
-							// Split into two operations: return existing debt and create new debt
-							returnDebt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: returnAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(returnDebt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-							newDebtAmount := amount - returnAmount
-							newDebt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: newDebtAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(newDebt, "debt", operationID); err != nil {
-								log.Printf("Error saving new debt: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							owes := "должен"
-							if isWoman[from] {
-								returnedVerb = "вернула"
-							}
-							if isWoman[username[1]] {
-								owes = "должна"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d и теперь %s %s %s %d.%02d\n",
-								from, returnedVerb, username[1], returnAmount/100, returnAmount%100, username[1], owes, from, newDebtAmount/100, newDebtAmount%100))
-						}
-					} else {
-						// Regular debt operation
-						debt := Debt{
-							From:   from,
-							To:     username[1],
-							Amount: amount,
-							Reason: reason,
-							ChatID: update.Message.Chat.ID,
-							Time:   time.Now(),
-						}
-						if err := saveDebtWithType(debt, "debt", operationID); err != nil {
-							log.Printf("Error saving debt: %v", err)
-							continue
-						}
-						owes := "должен"
-						if isWoman[username[1]] {
-							owes = "должна"
-						}
-						response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", username[1], owes, from, amount/100, amount%100))
-					}
+				response.WriteString(lang.T("stats.categories", describePeriod(lang, days)) + "\n\n")
+				sum := 0
+				for _, total := range totals {
+					sum += total.Amount
+					response.WriteString(lang.T("stats.category", total.Category, formatAmount(lang, total.Amount), lang.Count("count.operations", total.Operations)) + "\n")
 				}
+				response.WriteString("\n" + lang.T("stats.total", formatAmount(lang, sum)))
 				msg.Text = response.String()
-				bot.Send(msg)
-				continue
-			default:
-				msg.Text = "Неизвестная команда"
+				break
 			}
 
-			bot.Send(msg)
-			continue
-		}
-
-		// Handle debt messages
-		text := update.Message.Text
-		
-		// First, check if it's an @all command
-		allRe := regexp.MustCompile(`@all\s+(\d+(?:\.\d+)?)(?:\s+(.+))?`)
-		allMatches := allRe.FindStringSubmatch(text)
-		
-		if allMatches != nil {
-			// Get all chat administrators
-			admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
-				ChatConfig: tgbotapi.ChatConfig{
-					ChatID: update.Message.Chat.ID,
-				},
-			})
+			members, err := store.MemberStats(update.Message.Chat.ID, since)
 			if err != nil {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при получении списка участников. Пожалуйста, попробуйте снова.")
-				bot.Send(msg)
-				continue
+				log.Printf("Error getting member stats: %v", err)
+				msg.Text = lang.T("error.stats")
+				break
+			}
+			if len(members) == 0 {
+				msg.Text = lang.T("stats.empty", describePeriod(lang, days))
+				break
+			}
+			expenses, err := store.LargestExpenses(update.Message.Chat.ID, since, 5)
+			if err != nil {
+				log.Printf("Error getting largest expenses: %v", err)
+				msg.Text = lang.T("error.stats")
+				break
+			}
+			busiestDays, err := store.BusiestDays(update.Message.Chat.ID, since, loc, 3)
+			if err != nil {
+				log.Printf("Error getting busiest days: %v", err)
+				msg.Text = lang.T("error.stats")
+				break
 			}
 
-			// Count active members (excluding bots)
-			activeMembers := 0
-			for _, admin := range admins {
-				if !admin.User.IsBot {
-					activeMembers++
+			var response strings.Builder
+			response.WriteString(lang.T("stats.title", describePeriod(lang, days)) + "\n\n")
+			response.WriteString(lang.T("stats.members") + "\n")
+			for i, member := range members {
+				net := formatAmount(lang, member.Net())
+				if member.Net() > 0 {
+					net = "+" + net
 				}
+				response.WriteString(lang.T("stats.member", i+1, member.User,
+					formatAmount(lang, member.Paid), formatAmount(lang, member.Consumed), net) + "\n")
 			}
 
-			if activeMembers <= 1 {
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Недостаточно участников в чате.")
-				bot.Send(msg)
-				continue
+			response.WriteString("\n" + lang.T("stats.largest") + "\n")
+			for _, expense := range expenses {
+				response.WriteString(fmt.Sprintf("• [%s] %s %s", expense.Time.In(loc).Format("02.01.2006"), expense.From, formatAmount(lang, expense.Amount)))
+				if expense.Reason != "" {
+					response.WriteString(fmt.Sprintf(" %s", expense.Reason))
+				}
+				response.WriteString("\n")
 			}
 
-			amount := parseMoney(allMatches[1])
-			reason := ""
-			if len(allMatches) > 2 {
-				reason = allMatches[2]
+			response.WriteString("\n" + lang.T("stats.busiest") + "\n")
+			for _, day := range busiestDays {
+				date := day.Day
+				if t, err := time.Parse("2006-01-02", day.Day); err == nil {
+					date = t.Format("02.01.2006")
+				}
+				response.WriteString(lang.T("stats.day", date, lang.Count("count.operations", day.Operations), formatAmount(lang, day.Amount)) + "\n")
 			}
-
-			// Split amount between all members
-			splitAmount := amount / activeMembers
-			from := update.Message.From.UserName
-
-			// Generate operation ID for this interaction
-			operationID, err := getNextOperationID()
-			if err != nil {
-				log.Printf("Error generating operation ID: %v", err)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при обработке операции. Пожалуйста, попробуйте снова.")
-				bot.Send(msg)
-				continue
+			msg.Text = response.String()
+		case "chart":
+			args := strings.Fields(update.Message.CommandArguments())
+			if len(args) == 0 || (args[0] != "balance" && args[0] != "spending") {
+				msg.Text = lang.T("chart.usage")
+				break
 			}
 
-			var response strings.Builder
-			response.WriteString(fmt.Sprintf("Разделено %d.%02d между %d участниками (по %d.%02d каждый):\n", amount/100, amount%100, activeMembers, splitAmount/100, splitAmount%100))
-
-			// Create debts for each member
-			for _, admin := range admins {
-				if !admin.User.IsBot && admin.User.UserName != from {
-					// Determine operation type and handle returns
-					netBalance, err := getNetBalance(update.Message.Chat.ID, from, admin.User.UserName)
-					if err != nil {
-						log.Printf("Error getting net balance: %v", err)
-						continue
+			var chart []byte
+			var err error
+			if args[0] == "balance" {
+				var balances []ledger.Balance
+				balances, err = chatLedger.Balances(update.Message.Chat.ID)
+				if err == nil && len(balances) == 0 {
+					msg.Text = lang.T("chart.no_debts")
+					break
+				}
+				chart, err = renderBalanceChart(lang, balances)
+			} else {
+				days := 30 // Default to 30 days if no period provided
+				if len(args) > 1 {
+					d, err := strconv.Atoi(args[1])
+					if err != nil || d <= 0 {
+						msg.Text = lang.T("chart.usage")
+						break
 					}
+					days = d
+				}
+				var members []storage.MemberStats
+				members, err = store.MemberStats(update.Message.Chat.ID, periodStart(getChatLocation(update.Message.Chat.ID), days))
+				if err == nil && len(members) == 0 {
+					msg.Text = lang.T("stats.empty", describePeriod(lang, days))
+					break
+				}
+				if err == nil {
+					chart, err = renderSpendingChart(lang, members, days)
+				}
+			}
+			if err != nil {
+				log.Printf("Error rendering chart: %v", err)
+				msg.Text = lang.T("error.chart")
+				break
+			}
 
-					if netBalance < 0 {
-						// This is a return operation
-						returnAmount := -netBalance // Convert negative balance to positive amount
-						if splitAmount <= returnAmount {
-							// Simple return - amount is less than or equal to existing debt
-							debt := Debt{
-								From:   from,
-								To:     admin.User.UserName,
-								Amount: splitAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(debt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							if (isWoman[from]) {
-								returnedVerb = "вернула"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", from, returnedVerb, admin.User.UserName, splitAmount/100, splitAmount%100))
-						} else {
-							// Split into two operations: return existing debt and create new debt
-							// First, return the existing debt
-							returnDebt := Debt{
-								From:   from,
-								To:     admin.User.UserName,
-								Amount: returnAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(returnDebt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-
-							// Then create new debt for the remaining amount
-							newDebtAmount := splitAmount - returnAmount
-							newDebt := Debt{
-								From:   from,
-								To:     admin.User.UserName,
-								Amount: newDebtAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(newDebt, "debt", operationID); err != nil {
-								log.Printf("Error saving new debt: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							owes := "должен"
-							if (isWoman[from]) {
-								returnedVerb = "вернула"
-							}
-							if (isWoman[admin.User.UserName]) {
-								owes = "должна"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d и теперь %s %s %s %d.%02d\n",
-								from, returnedVerb, admin.User.UserName, returnAmount/100, returnAmount%100, admin.User.UserName, owes, from, newDebtAmount/100, newDebtAmount%100))
-						}
-					} else {
-						// Regular debt operation
-						debt := Debt{
-							From:   from,
-							To:     admin.User.UserName,
-							Amount: splitAmount,
-							Reason: reason,
-							ChatID: update.Message.Chat.ID,
-							Time:   time.Now(),
-						}
-						if err := saveDebtWithType(debt, "debt", operationID); err != nil {
-							log.Printf("Error saving debt: %v", err)
-							continue
-						}
-						owes := "должен"
-						if (isWoman[admin.User.UserName]) {
-							owes = "должна"
-						}
-						response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", admin.User.UserName, owes, from, splitAmount/100, splitAmount%100))
-					}
+			photo := tgbotapi.NewPhoto(update.Message.Chat.ID, tgbotapi.FileBytes{Name: args[0] + ".png", Bytes: chart})
+			bot.Send(photo)
+			return
+		case "export":
+			args := strings.Fields(update.Message.CommandArguments())
+			if len(args) == 0 || (args[0] != "csv" && args[0] != "json") {
+				msg.Text = lang.T("export.usage")
+				break
+			}
+			loc := getChatLocation(update.Message.Chat.ID)
+			var since time.Time // Export everything if no period provided
+			if len(args) > 1 {
+				d, err := strconv.Atoi(args[1])
+				if err != nil || d <= 0 {
+					msg.Text = lang.T("export.usage")
+					break
 				}
+				since = periodStart(loc, d)
 			}
 
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, response.String())
-			bot.Send(msg)
-			continue
-		}
+			entries, err := getLedgerEntries(update.Message.Chat.ID, since, loc)
+			if err != nil {
+				log.Printf("Error getting ledger entries: %v", err)
+				msg.Text = lang.T("error.export")
+				break
+			}
+			if len(entries) == 0 {
+				msg.Text = lang.T("export.empty")
+				break
+			}
 
-		// Handle multiple users
-		multiRe := regexp.MustCompile(`((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?`)
-		multiMatches := multiRe.FindStringSubmatch(text)
+			var data []byte
+			if args[0] == "csv" {
+				data, err = exportCSV(entries)
+			} else {
+				data, err = exportJSON(entries)
+			}
+			if err != nil {
+				log.Printf("Error encoding export: %v", err)
+				msg.Text = lang.T("error.export")
+				break
+			}
+
+			name := fmt.Sprintf("ledger-%d-%s.%s", update.Message.Chat.ID, clock().In(loc).Format("2006-01-02"), args[0])
+			document := tgbotapi.NewDocument(update.Message.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: data})
+			document.Caption = lang.N("export.caption", len(entries), len(entries))
+			bot.Send(document)
+			return
+		case "timezone":
+			args := strings.TrimSpace(update.Message.CommandArguments())
+			if args == "" {
+				msg.Text = lang.T("timezone.current", getChatLocation(update.Message.Chat.ID))
+				break
+			}
+			loc, err := time.LoadLocation(args)
+			if err != nil || args == "Local" {
+				msg.Text = lang.T("timezone.unknown")
+				break
+			}
+			if err := setChatTimezone(update.Message.Chat.ID, loc.String()); err != nil {
+				log.Printf("Error saving chat time zone: %v", err)
+				msg.Text = lang.T("error.timezone")
+				break
+			}
+			msg.Text = lang.T("timezone.set", loc, clock().In(loc).Format("02.01.2006 15:04"))
+		case "gender":
+			user := update.Message.From.UserName
+			if user == "" {
+				msg.Text = lang.T("gender.no_username")
+				break
+			}
+			args := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+			if args == "" {
+				msg.Text = lang.T("gender.current", user, describeGender(lang, getUserGender(user)))
+				break
+			}
+			gender, ok := genderNames[args]
+			if !ok {
+				msg.Text = lang.T("gender.usage")
+				break
+			}
+			if err := store.SetUserGender(user, gender); err != nil {
+				log.Printf("Error saving user gender: %v", err)
+				msg.Text = lang.T("error.gender")
+				break
+			}
+			msg.Text = lang.T("gender.set", user, describeGender(lang, gender))
+		case "lang":
+			msg.Text = langCommand(update.Message.Chat.ID, update.Message.CommandArguments(), lang)
+		case "mybalance":
+			msg.Text = lang.T("dashboard.in_group")
+		case "notify":
+			msg.Text = lang.T("notify.in_group")
+		case "remind":
+			msg.Text = remindCommand(update.Message.Chat.ID, update.Message.CommandArguments(), lang)
+		case "recurring":
+			msg.Text = recurringCommand(update.Message.Chat.ID, update.Message.From.UserName, update.Message.CommandArguments(), lang)
+		case "nudge":
+			msg.Text = nudgeCommand(update.Message.Chat.ID, update.Message.From.UserName, update.Message.CommandArguments(), lang)
+		case "import":
+			handleImportCommand(bot, update.Message)
+			return
+		case "each":
+			// /each @username1 [@username2 ...] amount [reason]
+			args := update.Message.CommandArguments()
+			// Regex: one or more @username, then amount, then optional reason
+			// Example: /each @ivan @maria 100 ужин
+			//          /each @ivan 50
+			//          /each @ivan @maria 100
+			//          /each @ivan 100 обед
+			//          /each @ivan @maria 100
+			//          /each @ivan @maria 100.50 ужин
+			//          /each @ivan 100.50
+			//          /each @ivan @maria 100.50
+			//          /each @ivan @maria 100.50 reason with spaces
+			// Regex: ((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?
+			multiRe := regexp.MustCompile(`((?:@\w+\s+)+)(\d+(?:\.\d+)?)(?:\s+(.+))?`)
+			multiMatches := multiRe.FindStringSubmatch(args)
+			if multiMatches == nil {
+				msg.Text = lang.T("each.usage")
+				bot.Send(msg)
+				return
+			}
 
-		if multiMatches != nil {
-			// Extract usernames
 			usernames := regexp.MustCompile(`@(\w+)`).FindAllStringSubmatch(multiMatches[1], -1)
 			if len(usernames) == 0 {
-				continue
+				msg.Text = lang.T("each.no_users")
+				bot.Send(msg)
+				return
 			}
 
 			amount := parseMoney(multiMatches[2])
@@ -729,237 +653,64 @@ func main() {
 			if len(multiMatches) > 3 {
 				reason = multiMatches[3]
 			}
+			reason, due := splitDueDate(reason)
+			if dueDatePassed(update.Message.Chat.ID, due) {
+				msg.Text = lang.T("due.past", formatDate(due))
+				break
+			}
 
-			// Split amount between users
-			splitAmount := amount / len(usernames)
+			var debtors []string
+			for _, username := range usernames {
+				debtors = append(debtors, username[1])
+			}
 			from := update.Message.From.UserName
-
-			// Generate operation ID for this interaction
-			operationID, err := getNextOperationID()
+			recorded, err := chatLedger.RecordSplit(ledger.Split{
+				ChatID:  update.Message.Chat.ID,
+				Payer:   from,
+				Debtors: debtors,
+				Share:   amount,
+				Reason:  reason,
+				Time:    update.Message.Time(),
+				Due:     due,
+			})
 			if err != nil {
-				log.Printf("Error generating operation ID: %v", err)
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при обработке операции. Пожалуйста, попробуйте снова.")
-				bot.Send(msg)
-				continue
+				log.Printf("Error saving operation: %v", err)
+				msg.Text = lang.T("error.operation")
+				break
 			}
 
 			var response strings.Builder
-			response.WriteString(fmt.Sprintf("Разделено %d.%02d между %d пользователями (по %d.%02d каждый):\n", amount/100, amount%100, len(usernames), splitAmount/100, splitAmount%100))
-
-			// Create debts for each user
-			for _, username := range usernames {
-				if username[1] != from {
-					// Determine operation type and handle returns
-					netBalance, err := getNetBalance(update.Message.Chat.ID, from, username[1])
-					if err != nil {
-						log.Printf("Error getting net balance: %v", err)
-						continue
-					}
-
-					if netBalance < 0 {
-						// This is a return operation
-						returnAmount := -netBalance // Convert negative balance to positive amount
-						if splitAmount <= returnAmount {
-							// Simple return - amount is less than or equal to existing debt
-							debt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: splitAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(debt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							if (isWoman[from]) {
-								returnedVerb = "вернула"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", from, returnedVerb,username[1], splitAmount/100, splitAmount%100))
-						} else {
-							// Split into two operations: return existing debt and create new debt
-							// First, return the existing debt
-							returnDebt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: returnAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(returnDebt, "return", operationID); err != nil {
-								log.Printf("Error saving return: %v", err)
-								continue
-							}
-
-							// Then create new debt for the remaining amount
-							newDebtAmount := splitAmount - returnAmount
-							newDebt := Debt{
-								From:   from,
-								To:     username[1],
-								Amount: newDebtAmount,
-								Reason: reason,
-								ChatID: update.Message.Chat.ID,
-								Time:   time.Now(),
-							}
-							if err := saveDebtWithType(newDebt, "debt", operationID); err != nil {
-								log.Printf("Error saving new debt: %v", err)
-								continue
-							}
-							returnedVerb := "вернул"
-							owes := "должен"
-							if (isWoman[from]) {
-								returnedVerb = "вернула"
-							}
-							if (isWoman[username[1]]) {
-								owes = "должна"
-							}
-							response.WriteString(fmt.Sprintf("%s %s %s %d.%02d и теперь %s %s %s %d.%02d\n",
-								from, returnedVerb, username[1], returnAmount/100, returnAmount%100, username[1], owes, from, newDebtAmount/100, newDebtAmount%100))
-						}
-					} else {
-						// Regular debt operation
-						debt := Debt{
-							From:   from,
-							To:     username[1],
-							Amount: splitAmount,
-							Reason: reason,
-							ChatID: update.Message.Chat.ID,
-							Time:   time.Now(),
-						}
-						if err := saveDebtWithType(debt, "debt", operationID); err != nil {
-							log.Printf("Error saving debt: %v", err)
-							continue
-						}
-						owes := "должен"
-						if (isWoman[username[1]]) {
-							owes = "должна"
-						}
-						response.WriteString(fmt.Sprintf("%s %s %s %d.%02d\n", username[1], owes, from, splitAmount/100, splitAmount%100))
-					}
-				}
-			}
-
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID, response.String())
-			bot.Send(msg)
-			continue
+			response.WriteString(lang.N("each.done", len(usernames), formatAmount(lang, amount), len(usernames)) + "\n")
+			writeRecorded(&response, lang, from, recorded)
+			notifyRecorded(bot, update.Message.Chat, from, recorded, reason)
+			msg.Text = response.String()
+		default:
+			msg.Text = lang.T("command.unknown")
 		}
-	}
-}
-
-// getDebtHistory returns all debts for a specific chat within the last n days
-func getDebtHistory(chatID int64, days int) ([]Debt, error) {
-	rows, err := db.Query(`
-		SELECT from_user, to_user, amount, reason, chat_id, created_at, operation_type
-		FROM debts
-		WHERE chat_id = ? AND datetime(created_at) >= datetime('now', ?)
-		ORDER BY created_at DESC
-	`, chatID, fmt.Sprintf("-%d days", days))
-	if err != nil {
-		log.Printf("Error querying debt history: %v", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var debts []Debt
-	for rows.Next() {
-		var debt Debt
-		var createdAt string
-		var operationType string
-		err := rows.Scan(&debt.From, &debt.To, &debt.Amount, &debt.Reason, &debt.ChatID, &createdAt, &operationType)
-		if err != nil {
-			log.Printf("Error scanning debt row: %v", err)
-			return nil, err
-		}
-		debt.Time, err = time.Parse(time.RFC3339Nano, createdAt)
-		if err != nil {
-			log.Printf("Error parsing time '%s': %v", createdAt, err)
-			return nil, err
-		}
-		debts = append(debts, debt)
-	}
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating debt rows: %v", err)
-		return nil, err
-	}
-	return debts, nil
-}
 
-// getChatDebts returns all debts for a specific chat
-func getChatDebts(chatID int64) []Debt {
-	rows, err := db.Query(`
-		SELECT from_user, to_user, amount, reason, chat_id, created_at
-		FROM debts
-		WHERE chat_id = ?
-		ORDER BY created_at DESC
-	`, chatID)
-	if err != nil {
-		log.Printf("Error querying chat debts: %v", err)
-		return nil
+		bot.Send(msg)
+		return
 	}
-	defer rows.Close()
 
-	var debts []Debt
-	for rows.Next() {
-		var debt Debt
-		var createdAt string
-		err := rows.Scan(&debt.From, &debt.To, &debt.Amount, &debt.Reason, &debt.ChatID, &createdAt)
-		if err != nil {
-			log.Printf("Error scanning debt row: %v", err)
-			continue
-		}
-		debt.Time, err = time.Parse(time.RFC3339Nano, createdAt)
-		if err != nil {
-			log.Printf("Error parsing time '%s': %v", createdAt, err)
-			continue
-		}
-		debts = append(debts, debt)
-	}
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating debt rows: %v", err)
-		return nil
+	// Handle answers to /import name mapping questions
+	if handleImportMapping(bot, update.Message) {
+		return
 	}
-	return debts
-}
 
-// Helper to get net balance between two users in a chat
-func getNetBalance(chatID int64, userA, userB string) (int, error) {
-	var sumAtoB, sumBtoA int
-	err := db.QueryRow(`SELECT COALESCE(SUM(amount),0) FROM debts WHERE chat_id = ? AND from_user = ? AND to_user = ?`, chatID, userA, userB).Scan(&sumAtoB)
-	if err != nil {
-		return 0, err
-	}
-	err = db.QueryRow(`SELECT COALESCE(SUM(amount),0) FROM debts WHERE chat_id = ? AND from_user = ? AND to_user = ?`, chatID, userB, userA).Scan(&sumBtoA)
-	if err != nil {
-		return 0, err
+	// Handle debt messages
+	debt, ok := parseDebtMessage(update.Message.Text)
+	if !ok {
+		return
 	}
-	return sumAtoB - sumBtoA, nil
-}
-
-// saveDebt saves a debt to the database
-func saveDebt(debt Debt) error {
-	_, err := db.Exec(`
-		INSERT INTO debts (from_user, to_user, amount, reason, chat_id, created_at)
-		VALUES (?, ?, ?, ?, ?, datetime(?))
-	`, debt.From, debt.To, debt.Amount, debt.Reason, debt.ChatID, debt.Time.Format("2006-01-02 15:04:05"))
-	if err != nil {
-		log.Printf("Error saving debt: %v", err)
-		return err
+	if dueDatePassed(update.Message.Chat.ID, debt.Due) {
+		bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, lang.T("due.past", formatDate(debt.Due))))
+		return
 	}
-	return nil
+	from := update.Message.From.UserName
+	reply := recordDebtMessage(bot, update.Message.Chat, from, debt, update.Message.Time(), lang)
+	bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, reply))
 }
 
-// Add a new saveDebtWithType function:
-func saveDebtWithType(debt Debt, opType string, operationID int) error {
-	_, err := db.Exec(`
-		INSERT INTO debts (from_user, to_user, amount, reason, chat_id, created_at, operation_type, operation_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, debt.From, debt.To, debt.Amount, debt.Reason, debt.ChatID, debt.Time.Format("2006-01-02 15:04:05"), opType, operationID)
-	return err
-} 
-
 func parseMoney(money string) (res int) {
 	parts := strings.Split(money, ".")
 	num, _ := strconv.Atoi(parts[0])
@@ -975,3 +726,36 @@ func parseMoney(money string) (res int) {
 	res += num
 	return
 }
+
+// formatAmount formats an amount in kopecks with the configured currency for
+// chat messages. Rubles and kopecks are counted nouns, e.g. 12345 is
+// "123 рубля 45 копеек" and 100 is "1 рубль"; other currencies are shown
+// with their symbol, e.g. 123.45 $.
+func formatAmount(lang i18n.Lang, amount int) string {
+	if cfg.Currency != "RUB" {
+		return formatMoney(amount) + " " + currencySymbols[cfg.Currency]
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	rubles, kopecks := amount/100, amount%100
+	switch {
+	case kopecks == 0:
+		return sign + lang.Count("count.rubles", rubles)
+	case rubles == 0:
+		return sign + lang.Count("count.kopecks", kopecks)
+	}
+	return sign + lang.Count("count.rubles", rubles) + " " + lang.Count("count.kopecks", kopecks)
+}
+
+// formatMoney formats an amount in kopecks as rubles, e.g. -12345 as -123.45
+func formatMoney(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+	"obshyakBot3/telegramtest"
+)
+
+var (
+	anna  = telegramtest.User(1, "anna")
+	ivan  = telegramtest.User(2, "ivan")
+	maria = telegramtest.User(3, "maria")
+)
+
+// conversation is a group chat with the bot against a fresh in-memory store
+type conversation struct {
+	t      *testing.T
+	server *telegramtest.Server
+	bot    telegramClient
+	chat   tgbotapi.Chat
+}
+
+func newConversation(t *testing.T) *conversation {
+	store = storage.OpenMemory()
+	chatLedger = ledger.New(store)
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	api, err := server.NewBot()
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	c := &conversation{t: t, server: server, bot: newBotClient(api, server.Endpoint()), chat: telegramtest.Group(-100, "Квартира")}
+	server.SetAdministrators(c.chat.ID, anna, ivan, maria)
+	return c
+}
+
+// handle handles an update and returns the replies to it in its chat
+func (c *conversation) handle(update tgbotapi.Update) []string {
+	c.server.Reset()
+	handleUpdate(c.bot, update)
+	return c.server.Replies(update.Message.Chat.ID)
+}
+
+// send handles a message from a user in the group and returns the single reply to it
+func (c *conversation) send(from tgbotapi.User, text string) string {
+	c.t.Helper()
+	replies := c.handle(c.server.Message(c.chat, from, text))
+	if len(replies) != 1 {
+		c.t.Fatalf("%s: %q: got %d replies %q, want 1", from.UserName, text, len(replies), replies)
+	}
+	return replies[0]
+}
+
+// expect fails unless text contains every one of want
+func expect(t *testing.T, text string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(text, w) {
+			t.Errorf("reply %q does not contain %q", text, w)
+		}
+	}
+}
+
+func TestDebt(t *testing.T) {
+	c := newConversation(t)
+	expect(t, c.send(anna, "@ivan @maria 300 пицца #еда"),
+		"Разделено 300 рублей между 2 пользователями (по 150 рублей каждый)",
+		"ivan должен anna 150 рублей",
+		"maria должен anna 150 рублей",
+		"Категория: продукты")
+	expect(t, c.send(anna, "@all 90 такси"), "между 3 участниками (по 30 рублей каждый)")
+	expect(t, c.send(anna, "/balance"), "ivan должен anna 180 рублей", "maria должен anna 180 рублей")
+}
+
+func TestReturn(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "@ivan 100 обед")
+	expect(t, c.send(ivan, "@anna 30"), "ivan вернул anna 30 рублей")
+	expect(t, c.send(anna, "/balance"), "ivan должен anna 70 рублей")
+
+	// Returning more than owed leaves a debt the other way
+	expect(t, c.send(ivan, "@anna 100"), "ivan вернул anna 70 рублей", "anna должен ivan 30 рублей")
+	expect(t, c.send(ivan, "/balance me"), "anna должен ivan 30 рублей")
+}
+
+func TestCancelOwnership(t *testing.T) {
+	c := newConversation(t)
+	expect(t, c.send(anna, "/cancel"), "В этом чате нет операций для отмены.")
+	c.send(anna, "@ivan 100 обед")
+	expect(t, c.send(ivan, "/cancel"), "Вы не можете отменить эту операцию. Операция была выполнена пользователем anna.")
+
+	cfg.Admins = []string{"maria"}
+	t.Cleanup(func() { cfg.Admins = nil })
+	expect(t, c.send(maria, "/cancel"), "Отменена последняя операция", "ivan должен anna 100 рублей обед", "Удалена 1 запись")
+	expect(t, c.send(anna, "/cancel"), "В этом чате нет операций для отмены.")
+	expect(t, c.send(anna, "/balance"), "Нет непогашенных долгов.")
+}
+
+func TestBalance(t *testing.T) {
+	c := newConversation(t)
+	expect(t, c.send(anna, "/balance"), "Нет непогашенных долгов.")
+	c.send(anna, "@ivan 100")
+	c.send(maria, "@anna 40")
+	c.send(anna, "@maria 40")
+
+	reply := c.send(anna, "/balance")
+	expect(t, reply, "Долги в этом чате:", "ivan должен anna 100 рублей")
+	if strings.Contains(reply, "maria") {
+		t.Errorf("settled debts in /balance: %q", reply)
+	}
+	expect(t, c.send(maria, "/balance me"), "У вас нет непогашенных долгов.")
+}
+
+func TestHistory(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "@ivan 100 обед #еда")
+	c.send(maria, "@ivan 50 кино")
+	c.send(ivan, "@anna 100")
+
+	reply := c.send(anna, "/history")
+	expect(t, reply, "История операций", "ivan должен anna 100 рублей обед #еда", "ivan должен maria 50 рублей кино", "ivan вернул anna 100 рублей")
+
+	reply = c.send(anna, "/history #еда")
+	expect(t, reply, "обед")
+	if strings.Contains(reply, "кино") {
+		t.Errorf("/history #еда lists other tags: %q", reply)
+	}
+	reply = c.send(anna, "/history type:return")
+	expect(t, reply, "ivan вернул anna")
+	if strings.Contains(reply, "должен") {
+		t.Errorf("/history type:return lists debts: %q", reply)
+	}
+}
+
+func TestHistoryPages(t *testing.T) {
+	c := newConversation(t)
+	long := strings.Repeat("очень длинная причина ", 40)
+	for i := 0; i < 12; i++ {
+		c.send(anna, fmt.Sprintf("@ivan %d %s", i+1, long))
+	}
+	c.send(maria, "@anna 5 кино")
+
+	// No page is longer than a message, however few rows fit on it
+	var markup tgbotapi.InlineKeyboardMarkup
+	page := c.server.Message(c.chat, anna, "/history @ivan")
+	for pages := 1; ; pages++ {
+		var replies []string
+		if pages == 1 {
+			replies = c.handle(page)
+		} else {
+			data := *markup.InlineKeyboard[0][len(markup.InlineKeyboard[0])-1].CallbackData
+			// The filter comes with the button, not from the message the page replies to
+			c.server.Reset()
+			handleUpdate(c.bot, c.server.Callback(tgbotapi.Message{MessageID: 1, Chat: &c.chat}, anna, data))
+			replies = c.server.Replies(c.chat.ID)
+		}
+		if len(replies) != 1 {
+			t.Fatalf("page %d: got replies %q", pages, replies)
+		}
+		if len(replies[0]) > maxMessageLength {
+			t.Errorf("page %d is %d bytes long", pages, len(replies[0]))
+		}
+		if strings.Contains(replies[0], "кино") {
+			t.Errorf("page %d ignores the filter: %q", pages, replies[0])
+		}
+		markup = tgbotapi.InlineKeyboardMarkup{}
+		for _, call := range c.server.Calls() {
+			if raw := call.Params.Get("reply_markup"); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &markup); err != nil {
+					t.Fatalf("reply_markup: %v", err)
+				}
+			}
+		}
+		if len(markup.InlineKeyboard) == 0 || markup.InlineKeyboard[0][len(markup.InlineKeyboard[0])-1].Text != "▶" {
+			expect(t, replies[0], fmt.Sprintf("(стр. %d из %d)", pages, pages), "ivan должен anna 1 рубль")
+			if pages < 3 {
+				t.Errorf("got %d pages, want the rows spread over several", pages)
+			}
+			break
+		}
+		if pages > 12 {
+			t.Fatal("pages never end")
+		}
+	}
+
+	c.server.Reset()
+	handleUpdate(c.bot, c.server.Callback(tgbotapi.Message{MessageID: 1, Chat: &c.chat}, anna, historyCallbackPrefix+"1"))
+	for _, call := range c.server.Calls() {
+		if call.Method == "editMessageText" {
+			t.Errorf("an out of date button turned the page: %q", call.Text())
+		}
+	}
+}
+
+func TestHistoryFilterEncoding(t *testing.T) {
+	filters := []string{"", "7", "@ivan #еда", "from 2026-09-01 to 2026-09-30 type:return", "30 @maria #отпуск_2024 type:debt"}
+	for _, args := range filters {
+		filter, err := parseHistoryFilter(args)
+		if err != nil {
+			t.Fatalf("parseHistoryFilter(%q): %v", args, err)
+		}
+		decoded, err := decodeHistoryFilter(filter.encode())
+		if err != nil || decoded != filter {
+			t.Errorf("%q: decoded %+v, %v; want %+v", args, decoded, err, filter)
+		}
+	}
+	for _, data := range []string{"", "7", "x|||||", "||||20260931|", "|||||loan"} {
+		if _, err := decodeHistoryFilter(data); err == nil {
+			t.Errorf("decodeHistoryFilter(%q) succeeded", data)
+		}
+	}
+}
+
+// exportCSV returns the file /export csv sends to the conversation's chat
+func (c *conversation) exportCSV() []byte {
+	c.t.Helper()
+	c.send(anna, "/export csv")
+	for _, call := range c.server.Calls() {
+		if call.Method == "sendDocument" {
+			return call.Files["document"]
+		}
+	}
+	c.t.Fatal("/export csv sent no document")
+	return nil
+}
+
+func TestImport(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "@ivan @maria 300 пицца")
+	c.send(ivan, "@anna 50")
+	data := c.exportCSV()
+
+	// Import the ledger into another chat, where ivan is called vanya
+	c.chat = telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(c.chat.ID, anna, telegramtest.User(2, "vanya"), maria)
+	replies := c.handle(c.server.Document(c.chat, anna, "ledger.csv", data, "/import"))
+	if len(replies) != 2 {
+		t.Fatalf("got replies %q, want a summary and a question", replies)
+	}
+	expect(t, replies[0], "Найдено: 2 операции, 3 участника.")
+	expect(t, replies[1], "Кто в этом чате «ivan»?")
+
+	expect(t, c.send(anna, "@vanya"), "Будет записано: 2 операции (3 записи)", "• ivan → @vanya")
+	expect(t, c.send(anna, "/import confirm"), "Импорт завершён. Записано: 2 операции (3 записи).")
+	expect(t, c.send(anna, "/balance"), "vanya должен anna 100 рублей", "maria должен anna 150 рублей")
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	c := newConversation(t)
+	due := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+	c.send(anna, "@ivan 100 =1+1 билеты до "+due)
+	c.send(ivan, "@anna 30 'кофе")
+	data := c.exportCSV()
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if got := strings.Join(records[0], ","); got != strings.Join(exportHeader, ",") {
+		t.Errorf("header = %s", got)
+	}
+	if reason, gotDue := records[1][6], records[1][7]; reason != "'=1+1 билеты" || gotDue != due {
+		t.Errorf("exported reason %q due %q, want an escaped formula due %s", reason, gotDue, due)
+	}
+
+	c.chat = telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(c.chat.ID, anna, ivan)
+	c.handle(c.server.Document(c.chat, anna, "ledger.csv", data, "/import"))
+	expect(t, c.send(anna, "/import confirm"), "Импорт завершён")
+	expect(t, c.send(anna, "/history"), "=1+1 билеты, вернуть до "+formatDate(mustParseDate(t, due)), "'кофе")
+	if imported := string(c.exportCSV()); !strings.Contains(imported, ",'=1+1 билеты,"+due+"\n") {
+		t.Errorf("export of the imported ledger lost the reason or due date: %s", imported)
+	}
+}
+
+func TestEscapeCSVCell(t *testing.T) {
+	for _, cell := range []string{"", "обед", "=SUM(A1)", "+7", "-5", "@ivan", "\tx", "\rx", "'", "'=1", "''", "a=b"} {
+		escaped := escapeCSVCell(cell)
+		if escaped != "" && strings.ContainsRune(formulaPrefixes, rune(escaped[0])) {
+			t.Errorf("escapeCSVCell(%q) = %q starts a formula", cell, escaped)
+		}
+		if got := unescapeCSVCell(escaped); got != cell {
+			t.Errorf("unescapeCSVCell(%q) = %q, want %q", escaped, got, cell)
+		}
+	}
+}
+
+func mustParseDate(t *testing.T, date string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestImportTwice(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "@ivan @maria 300 пицца")
+	c.send(ivan, "@anna 50")
+	data := c.exportCSV()
+
+	c.chat = telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(c.chat.ID, anna, ivan, maria)
+	c.handle(c.server.Document(c.chat, anna, "ledger.csv", data, "/import"))
+	expect(t, c.send(anna, "/import confirm"), "Записано: 2 операции (3 записи).")
+	c.send(maria, "@anna 70 кофе")
+
+	// Importing the chat's own ledger again records nothing twice
+	data = c.exportCSV()
+	c.handle(c.server.Document(c.chat, anna, "ledger.csv", data, "/import"))
+	expect(t, c.send(anna, "/import confirm"), "Записано: 0 операций (0 записей).", "Уже были в чате и пропущены: 3 операции.")
+	expect(t, c.send(anna, "/balance"), "ivan должен anna 100 рублей", "maria должен anna 80 рублей")
+}
+
+func TestImportCurrency(t *testing.T) {
+	c := newConversation(t)
+	data := []byte("Date,Description,Category,Cost,Currency,anna,ivan\n" +
+		"2024-03-10,Ужин,Dining out,100.00,RUB,50.00,-50.00\n" +
+		"2024-03-11,Dinner,Dining out,20.00,USD,10.00,-10.00\n")
+	replies := c.handle(c.server.Document(c.chat, anna, "splitwise.csv", data, "/import"))
+	if len(replies) != 1 {
+		t.Fatalf("got replies %q, want the error", replies)
+	}
+	expect(t, replies[0], "строка 3: валюта USD, а учёт ведётся в RUB")
+}
+
+// failingStore fails to save several operations at once
+type failingStore struct {
+	storage.Store
+}
+
+func (failingStore) SaveOperations([]storage.Operation) ([]int, error) {
+	return nil, errors.New("disk full")
+}
+
+func TestImportFailureRecordsNothing(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "@ivan 100 обед")
+	data := c.exportCSV()
+
+	c.chat = telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(c.chat.ID, anna, ivan)
+	c.handle(c.server.Document(c.chat, anna, "ledger.csv", data, "/import"))
+	memory := store
+	store = failingStore{memory}
+	chatLedger = ledger.New(store)
+	expect(t, c.send(anna, "/import confirm"), "Ошибка при импорте, ничего не записано.")
+	store = memory
+	chatLedger = ledger.New(store)
+	expect(t, c.send(anna, "/balance"), "Нет непогашенных долгов.")
+}
+
+func TestImportDownloadFailure(t *testing.T) {
+	c := newConversation(t)
+	update := c.server.Message(c.chat, anna, "")
+	update.Message.Caption = "/import"
+	update.Message.Document = &tgbotapi.Document{FileID: "missing", FileName: "ledger.csv", FileSize: 10}
+	replies := c.handle(update)
+	if len(replies) != 1 || replies[0] != "Ошибка при загрузке файла. Пожалуйста, попробуйте снова." {
+		t.Errorf("got replies %q, want a download error", replies)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	c := newConversation(t)
+	dir := t.TempDir()
+	recording := filepath.Join(dir, "updates.jsonl")
+	rec, err := openRecorder(recording)
+	if err != nil {
+		t.Fatalf("openRecorder: %v", err)
+	}
+	c.bot = recordingClient{telegramClient: c.bot, recorder: rec}
+
+	// Record a conversation with an import and save its transcript
+	c.send(anna, "@ivan 100 обед")
+	data := c.exportCSV()
+	c.chat = telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(c.chat.ID, anna, ivan)
+	var transcript strings.Builder
+	for _, update := range []tgbotapi.Update{
+		c.server.Document(c.chat, anna, "ledger.csv", data, "/import"),
+		c.server.Message(c.chat, anna, "/import confirm"),
+		c.server.Message(c.chat, anna, "/balance"),
+	} {
+		if err := rec.recordUpdate(update); err != nil {
+			t.Fatalf("recordUpdate: %v", err)
+		}
+		c.handle(update)
+		writeTranscript(&transcript, update, c.server.Calls())
+	}
+	rec.Close()
+	expect(t, transcript.String(), "Импорт завершён", "ivan должен anna 100 рублей")
+	expected := filepath.Join(dir, "transcript.txt")
+	if err := os.WriteFile(expected, []byte(transcript.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replay downloads the recorded file again
+	if status := runReplay([]string{"-expect", expected, recording}); status != 0 {
+		t.Errorf("replay differs from the recorded transcript")
+	}
+}
+
+func TestReplayUsesRecordedTime(t *testing.T) {
+	c := newConversation(t)
+	recording := filepath.Join(t.TempDir(), "updates.jsonl")
+	rec, err := openRecorder(recording)
+	if err != nil {
+		t.Fatalf("openRecorder: %v", err)
+	}
+	recorded := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return recorded }
+	t.Cleanup(func() { clock = time.Now })
+
+	// /history shows the last day and /timezone the current time
+	for _, text := range []string{"@ivan 100 обед", "/history", "/timezone UTC"} {
+		update := c.server.Message(c.chat, anna, text)
+		update.Message.Date = int(recorded.Unix())
+		if err := rec.recordUpdate(update); err != nil {
+			t.Fatalf("recordUpdate: %v", err)
+		}
+	}
+	rec.Close()
+	clock = time.Now
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	status := runReplay([]string{recording})
+	w.Close()
+	os.Stdout = stdout
+	transcript, _ := io.ReadAll(r)
+	if status != 0 {
+		t.Fatalf("replay exited with %d", status)
+	}
+	expect(t, string(transcript), "[10.03.2024 09:00] ivan должен anna 100 рублей обед", "Сейчас 10.03.2024 09:00.")
+	if got := clock(); got.Equal(recorded) {
+		t.Errorf("the replay left the clock at %s", got)
+	}
+}
+
+func TestLegacyWomen(t *testing.T) {
+	c := newConversation(t)
+	if err := store.SetUserGender("maria", storage.GenderNeutral); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Women = []string{"anna", "maria"}
+	t.Cleanup(func() { cfg.Women = nil })
+	if err := importLegacyWomen(); err != nil {
+		t.Fatalf("importLegacyWomen: %v", err)
+	}
+
+	// Users who chose a gender keep it
+	expect(t, c.send(ivan, "@anna @maria 200"), "anna должна ivan 100 рублей", "maria — долг перед ivan 100 рублей")
+}
+
+func TestScheduledJobsRunOnChatWorkers(t *testing.T) {
+	c := newConversation(t)
+	expect(t, c.send(anna, "/recurring add daily @ivan 100 обед"), "Регулярная операция #1")
+	recurrings, err := store.Recurrings(c.chat.ID)
+	if err != nil || len(recurrings) != 1 {
+		t.Fatalf("Recurrings: %v, %v", recurrings, err)
+	}
+	now := time.Now()
+	recurring := recurrings[0]
+	recurring.NextRun = now.Add(-time.Hour)
+	if _, err := store.UpdateRecurring(recurring); err != nil {
+		t.Fatal(err)
+	}
+
+	c.server.Reset()
+	var handled []tgbotapi.Update
+	workers := newDispatcher(2, 1, func(update tgbotapi.Update) { handled = append(handled, update) })
+	runDueJobs(c.bot, workers, now)
+	workers.close()
+
+	replies := c.server.Replies(c.chat.ID)
+	if len(replies) != 1 {
+		t.Fatalf("got replies %q, want the recorded operation", replies)
+	}
+	expect(t, replies[0], "Регулярная операция #1 «@ivan 100 обед»", "ivan должен anna 100 рублей")
+	if len(handled) != 0 {
+		t.Errorf("scheduled jobs were handled as updates: %v", handled)
+	}
+}
+
+func TestRecurringCatchesUpAfterRestart(t *testing.T) {
+	c := newConversation(t)
+	expect(t, c.send(anna, "/recurring add daily @ivan 100 обед"), "Регулярная операция #1")
+	recurrings, err := store.Recurrings(c.chat.ID)
+	if err != nil || len(recurrings) != 1 {
+		t.Fatalf("Recurrings: %v, %v", recurrings, err)
+	}
+	// The bot was down for the last three runs
+	now := time.Now().Truncate(time.Second)
+	recurring := recurrings[0]
+	recurring.NextRun = now.AddDate(0, 0, -3).Add(time.Hour)
+	if _, err := store.UpdateRecurring(recurring); err != nil {
+		t.Fatal(err)
+	}
+
+	c.server.Reset()
+	workers := newDispatcher(2, 1, func(tgbotapi.Update) {})
+	runDueJobs(c.bot, workers, now)
+	workers.close()
+
+	replies := c.server.Replies(c.chat.ID)
+	if len(replies) != 3 {
+		t.Fatalf("got replies %q, want one per missed run", replies)
+	}
+	for i, reply := range replies {
+		expect(t, reply, "за "+recurring.NextRun.AddDate(0, 0, i).In(getChatLocation(c.chat.ID)).Format("02.01.2006"))
+	}
+	recurrings, err = store.Recurrings(c.chat.ID)
+	if err != nil || len(recurrings) != 1 {
+		t.Fatalf("Recurrings: %v, %v", recurrings, err)
+	}
+	if want := now.Add(time.Hour); !recurrings[0].NextRun.Equal(want) {
+		t.Errorf("next run = %s, want %s", recurrings[0].NextRun, want)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	ru, en := i18n.Russian, i18n.English
+	tests := []struct {
+		lang   i18n.Lang
+		amount int
+		want   string
+	}{
+		{ru, 0, "0 рублей"},
+		{ru, 100, "1 рубль"},
+		{ru, 2100, "21 рубль"},
+		{ru, 300, "3 рубля"},
+		{ru, 1100, "11 рублей"},
+		{ru, 12345, "123 рубля 45 копеек"},
+		{ru, 101, "1 рубль 1 копейка"},
+		{ru, 52, "52 копейки"},
+		{ru, -2500, "-25 рублей"},
+		{en, 100, "1 ruble"},
+		{en, 250, "2 rubles 50 kopecks"},
+	}
+	for _, test := range tests {
+		if got := formatAmount(test.lang, test.amount); got != test.want {
+			t.Errorf("formatAmount(%s, %d) = %q, want %q", test.lang, test.amount, got, test.want)
+		}
+	}
+
+	cfg.Currency = "USD"
+	t.Cleanup(func() { cfg.Currency = "RUB" })
+	if got := formatAmount(ru, 12345); got != "123.45 $" {
+		t.Errorf("formatAmount in USD = %q, want 123.45 $", got)
+	}
+}
+
+func TestDigestSplitsLongNotifications(t *testing.T) {
+	c := newConversation(t)
+	long := strings.Repeat("• ivan должен anna 100 рублей\n", 300)
+	sendDigest(c.bot, anna.ID, []string{"коротко", long, strings.Repeat("щ", 5000)})
+
+	replies := c.server.Replies(anna.ID)
+	var sent strings.Builder
+	for _, reply := range replies {
+		if len(reply) > maxMessageLength {
+			t.Errorf("sent a message of %d bytes", len(reply))
+		}
+		if !utf8.ValidString(reply) {
+			t.Errorf("sent a message split inside a character")
+		}
+		sent.WriteString(reply)
+	}
+	if len(replies) < 4 {
+		t.Errorf("sent %d messages, want the long notifications split", len(replies))
+	}
+	if got, want := strings.Count(sent.String(), "ivan должен anna"), 300; got != want {
+		t.Errorf("sent %d lines of the long notification, want %d", got, want)
+	}
+	if got := strings.Count(sent.String(), "щ"); got != 5000 {
+		t.Errorf("sent %d characters of the unbroken notification, want 5000", got)
+	}
+}
+
+func TestPastDueDate(t *testing.T) {
+	c := newConversation(t)
+	c.send(anna, "/timezone Pacific/Kiritimati")
+	today := time.Now().In(getChatLocation(c.chat.ID))
+	yesterday := today.AddDate(0, 0, -1).Format("2006-01-02")
+
+	want := "Срок возврата " + today.AddDate(0, 0, -1).Format("02.01.2006") + " уже прошёл."
+	expect(t, c.send(anna, "@ivan 100 билеты до "+yesterday), want)
+	expect(t, c.send(anna, "/each @ivan 100 билеты by "+yesterday), want)
+	expect(t, c.send(anna, "/recurring add daily @ivan 100 билеты до "+yesterday), "Регулярная операция не может иметь срок возврата")
+	expect(t, c.send(anna, "/recurring add daily @ivan 100 билеты до "+today.Format("2006-01-02")), "Регулярная операция не может иметь срок возврата")
+	expect(t, c.send(anna, "/balance"), "Нет непогашенных долгов.")
+
+	expect(t, c.send(anna, "@ivan 100 билеты до "+today.Format("2006-01-02")), "Вернуть до "+today.Format("02.01.2006"))
+}
+
+func TestChartUsage(t *testing.T) {
+	c := newConversation(t)
+	usage := "Использование: /chart balance или /chart spending [дней]"
+	for _, text := range []string{"/chart", "/chart pie", "/chart spending 0", "/chart spending -7", "/chart spending week"} {
+		if reply := c.send(anna, text); reply != usage {
+			t.Errorf("%s: got %q, want usage", text, reply)
+		}
+	}
+
+	c.send(anna, "@ivan 100")
+	c.server.Reset()
+	handleUpdate(c.bot, c.server.Message(c.chat, anna, "/chart spending 7"))
+	calls := c.server.Calls()
+	if len(calls) != 1 || calls[0].Method != "sendPhoto" {
+		t.Errorf("/chart spending 7 made calls %v, want a photo", calls)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// maxMessageLength is the longest text Telegram accepts in a single message
+const maxMessageLength = 4096
+
+// notifyModes maps the arguments of /notify to notification modes
+var notifyModes = map[string]storage.NotifyMode{
+	"now":   storage.NotifyNow,
+	"daily": storage.NotifyDaily,
+	"mute":  storage.NotifyMute,
+	"off":   storage.NotifyMute,
+}
+
+// notifyCommand handles /notify in a private chat, showing or changing how
+// the user hears about operations involving them. Only users who have
+// written to the bot privately can be sent direct messages, which makes
+// notifications opt-in.
+func notifyCommand(user *tgbotapi.User, args string, lang i18n.Lang) string {
+	if user.UserName == "" {
+		return lang.T("notify.no_username")
+	}
+	args = strings.ToLower(strings.TrimSpace(args))
+	if args == "" {
+		mode, err := store.NotifyMode(user.ID)
+		if err != nil {
+			log.Printf("Error getting notification mode: %v", err)
+			return lang.T("error.notify")
+		}
+		return lang.T("notify.current", describeNotifyMode(lang, mode))
+	}
+	mode, ok := notifyModes[args]
+	if !ok {
+		return lang.T("notify.usage")
+	}
+	if err := store.SetNotifyMode(user.ID, mode); err != nil {
+		log.Printf("Error saving notification mode: %v", err)
+		return lang.T("error.notify")
+	}
+	if mode == storage.NotifyMute {
+		if err := store.DropNotifications(user.ID); err != nil {
+			log.Printf("Error dropping queued notifications: %v", err)
+		}
+	}
+	return lang.T("notify.set", describeNotifyMode(lang, mode))
+}
+
+// describeNotifyMode names a notification mode in a /notify reply
+func describeNotifyMode(lang i18n.Lang, mode storage.NotifyMode) string {
+	switch mode {
+	case storage.NotifyNow:
+		return lang.T("notify.mode.now")
+	case storage.NotifyDaily:
+		return lang.T("notify.mode.daily")
+	case storage.NotifyMute:
+		return lang.T("notify.mode.mute")
+	default:
+		return lang.T("notify.mode.unset")
+	}
+}
+
+// notifyRecorded tells every debtor of a recorded split other than the payer
+// what it means for them
+func notifyRecorded(bot telegramClient, chat *tgbotapi.Chat, payer string, recorded ledger.Recorded, reason string) {
+	for _, share := range recorded.Shares {
+		share := share
+		notifyUser(bot, share.Debtor, payer, func(lang i18n.Lang) string {
+			text := lang.G("notify.recorded", i18n.Gender(getUserGender(payer)), payer, chatTitle(lang, chat)) +
+				"\n• " + describeShare(lang, payer, share)
+			if reason != "" {
+				text += " " + reason
+			}
+			if !recorded.Due.IsZero() {
+				text += "\n" + lang.T("recorded.due", formatDate(recorded.Due))
+			}
+			return text
+		})
+	}
+}
+
+// notifyCancelled tells everyone named in a cancelled operation other than
+// the user who cancelled it which of their entries were deleted
+func notifyCancelled(bot telegramClient, chat *tgbotapi.Chat, author string, cancelled ledger.Cancelled) {
+	var users []string
+	entries := make(map[string][]storage.Entry)
+	for _, entry := range cancelled.Entries {
+		for _, user := range []string{entry.From, entry.To} {
+			if _, seen := entries[user]; !seen {
+				users = append(users, user)
+			}
+			entries[user] = append(entries[user], entry)
+		}
+	}
+	for _, user := range users {
+		userEntries := entries[user]
+		notifyUser(bot, user, author, func(lang i18n.Lang) string {
+			var text strings.Builder
+			text.WriteString(lang.G("notify.cancelled", i18n.Gender(getUserGender(author)), author, chatTitle(lang, chat)))
+			for _, entry := range userEntries {
+				text.WriteString("\n• " + describeEntry(lang, entry))
+			}
+			return text.String()
+		})
+	}
+}
+
+// notifyUser sends or queues a notification rendered in the user's language,
+// depending on how they chose to be notified. Users are not told about their
+// own actions.
+func notifyUser(bot telegramClient, username, author string, render func(lang i18n.Lang) string) {
+	if username == author {
+		return
+	}
+	userID, err := store.UserID(username)
+	if err != nil {
+		log.Printf("Error getting user ID: %v", err)
+		return
+	}
+	if userID == 0 {
+		return
+	}
+	mode, err := store.NotifyMode(userID)
+	if err != nil {
+		log.Printf("Error getting notification mode: %v", err)
+		return
+	}
+
+	// The private chat with a user has the user's ID
+	switch mode {
+	case storage.NotifyNow:
+		if _, err := bot.Send(tgbotapi.NewMessage(userID, render(getChatLang(userID)))); err != nil {
+			log.Printf("Error notifying user %d: %v", userID, err)
+		}
+	case storage.NotifyDaily:
+		if err := store.QueueNotification(userID, render(getChatLang(userID))); err != nil {
+			log.Printf("Error queueing notification: %v", err)
+		}
+	}
+}
+
+// chatTitle names a group chat in a notification
+func chatTitle(lang i18n.Lang, chat *tgbotapi.Chat) string {
+	if chat.Title == "" {
+		return lang.T("dashboard.untitled", chat.ID)
+	}
+	return chat.Title
+}
+
+// knownChat returns a group chat by ID with the title the bot last saw it
+// under, for messages sent outside of an update from it
+func knownChat(chatID int64) *tgbotapi.Chat {
+	chat := &tgbotapi.Chat{ID: chatID}
+	saved, err := store.Chat(chatID)
+	if err != nil {
+		if err != storage.ErrNotFound {
+			log.Printf("Error getting chat: %v", err)
+		}
+		return chat
+	}
+	chat.Title = saved.Title
+	return chat
+}
+
+// runDigests sends the queued notifications once a day at the configured
+// hour until ctx is done
+func runDigests(ctx context.Context, bot telegramClient, workers *dispatcher) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	var lastDay string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			day := now.Format("2006-01-02")
+			if now.Hour() != cfg.DigestHour || day == lastDay {
+				continue
+			}
+			lastDay = day
+			sendDigests(bot, workers)
+		}
+	}
+}
+
+// sendDigests sends every user their queued notifications on the worker of
+// their private chat
+func sendDigests(bot telegramClient, workers *dispatcher) {
+	notifications, err := store.TakeNotifications()
+	if err != nil {
+		log.Printf("Error taking queued notifications: %v", err)
+		return
+	}
+	for userID, texts := range notifications {
+		// The private chat with a user has the user's ID
+		userID, texts := userID, texts
+		workers.run(userID, func() { sendDigest(bot, userID, texts) })
+	}
+}
+
+// sendDigest sends a user their queued notifications, split into messages
+// Telegram accepts. Users who muted notifications since get nothing.
+func sendDigest(bot telegramClient, userID int64, texts []string) {
+	mode, err := store.NotifyMode(userID)
+	if err != nil {
+		log.Printf("Error getting notification mode: %v", err)
+		return
+	}
+	if mode == storage.NotifyMute {
+		return
+	}
+
+	lang := getChatLang(userID)
+	digest := lang.T("notify.digest")
+	for _, text := range texts {
+		for _, part := range splitMessage(text, maxMessageLength) {
+			if len(digest)+len(part)+2 > maxMessageLength {
+				sendNotification(bot, userID, digest)
+				digest = part
+				continue
+			}
+			digest += "\n\n" + part
+		}
+	}
+	sendNotification(bot, userID, digest)
+}
+
+// splitMessage splits text into parts of at most limit bytes, at line breaks
+// where possible and never inside a UTF-8 character
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for len(text) > limit {
+		cut := strings.LastIndexByte(text[:limit+1], '\n')
+		if cut <= 0 {
+			cut = limit
+			for !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimPrefix(text[cut:], "\n")
+	}
+	return append(parts, text)
+}
+
+// sendNotification sends a direct message, logging users who blocked the bot
+func sendNotification(bot telegramClient, userID int64, text string) {
+	if _, err := bot.Send(tgbotapi.NewMessage(userID, text)); err != nil {
+		log.Printf("Error notifying user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// pollTimeout is how many seconds a getUpdates request waits for updates
+	pollTimeout = 60
+	// pollRetryDelay is how long polling pauses after a failed request
+	pollRetryDelay = 3 * time.Second
+	// pollPendingDelay is how long polling waits for the workers when Telegram
+	// only repeats updates that are still being handled
+	pollPendingDelay = time.Second
+)
+
+// pollUpdates receives updates for pool by long polling until the returned
+// function is called. Telegram forgets every update before the offset of a
+// getUpdates request, so requests only move the offset past the updates pool
+// has handled: updates still queued or running when the bot stops are
+// delivered again after a restart. Updates Telegram repeats are skipped.
+// Stopping cancels the request in progress and returns once nothing more
+// will be sent on the channel.
+func pollUpdates(bot telegramClient, pool *dispatcher) (tgbotapi.UpdatesChannel, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer close(updates)
+		next := 0 // ID after the last update received
+		for ctx.Err() == nil {
+			config := tgbotapi.NewUpdate(pool.offset())
+			config.Timeout = pollTimeout
+			batch, err := bot.PollUpdates(ctx, config)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("Error getting updates: %v, retrying in %v", err, pollRetryDelay)
+				select {
+				case <-time.After(pollRetryDelay):
+				case <-ctx.Done():
+				}
+				continue
+			}
+
+			received := false
+			for _, update := range batch {
+				if update.UpdateID < next {
+					continue
+				}
+				next = update.UpdateID + 1
+				received = true
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// Telegram answers at once while unhandled updates are left
+			if !received && len(batch) > 0 {
+				select {
+				case <-pool.progress():
+				case <-time.After(pollPendingDelay):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	return updates, func() {
+		cancel()
+		<-done
+	}
+}
+
+// confirmUpdates tells Telegram that the updates before offset were handled.
+// Polling must have stopped: Telegram ends one of two concurrent requests
+// with a conflict.
+func confirmUpdates(bot telegramClient, offset int) {
+	config := tgbotapi.NewUpdate(offset)
+	config.Limit = 1
+	if _, err := bot.PollUpdates(context.Background(), config); err != nil {
+		log.Printf("Error confirming updates before %d: %v", offset, err)
+	}
+}
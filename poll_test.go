@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+	"obshyakBot3/telegramtest"
+)
+
+// blockingStore holds saving the operations of a chat until release is closed
+type blockingStore struct {
+	storage.Store
+	chatID  int64
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingStore) SaveOperations(ops []storage.Operation) ([]int, error) {
+	if len(ops) > 0 && ops[0].ChatID == s.chatID {
+		close(s.started)
+		<-s.release
+	}
+	return s.Store.SaveOperations(ops)
+}
+
+// pollUntilStopped serves the updates pushed to the conversation's server
+// like main does until stop is called, and returns the offset it confirmed
+func (c *conversation) pollUntilStopped() (stop func() int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		offset := serve(ctx, c.bot, func(pool *dispatcher) (tgbotapi.UpdatesChannel, func()) {
+			return pollUpdates(c.bot, pool)
+		}, nil)
+		confirmUpdates(c.bot, offset)
+		done <- offset
+	}()
+	return func() int {
+		cancel()
+		select {
+		case offset := <-done:
+			return offset
+		case <-time.After(5 * time.Second):
+			c.t.Fatal("serve did not stop")
+			return 0
+		}
+	}
+}
+
+// waitForReply waits until the bot answered in a chat
+func (c *conversation) waitForReply(chatID int64) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.server.Replies(chatID)) == 0 {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("no reply in chat %d", chatID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPollingConfirmsHandledUpdates(t *testing.T) {
+	c := newConversation(t)
+	first := c.server.Message(c.chat, anna, "@ivan 50 обед")
+	last := c.server.Message(c.chat, ivan, "/balance")
+	c.server.Push(first, last)
+
+	stop := c.pollUntilStopped()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.server.Replies(c.chat.ID)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	offset := stop()
+
+	if offset != last.UpdateID+1 {
+		t.Errorf("serve returned offset %d, want %d", offset, last.UpdateID+1)
+	}
+	offsets := c.server.Offsets()
+	if len(offsets) == 0 || offsets[len(offsets)-1] != last.UpdateID+1 {
+		t.Errorf("getUpdates offsets %v, want the last one to confirm update %d", offsets, last.UpdateID)
+	}
+}
+
+func TestPollingKeepsUnhandledUpdates(t *testing.T) {
+	c := newConversation(t)
+	previous := cfg
+	cfg.ShutdownTimeout = 100 * time.Millisecond
+	memory := store
+	blocking := blockingStore{Store: memory, chatID: c.chat.ID, started: make(chan struct{}), release: make(chan struct{})}
+	store = blocking
+	chatLedger = ledger.New(store)
+	t.Cleanup(func() {
+		cfg = previous
+		store = memory
+		chatLedger = ledger.New(store)
+	})
+
+	// The update in the first chat is still running when the bot stops, the
+	// later one in another chat is done
+	other := telegramtest.Group(-200, "Дача")
+	c.server.SetAdministrators(other.ID, anna, ivan)
+	stuck := c.server.Message(c.chat, anna, "@ivan 50 обед")
+	c.server.Push(stuck, c.server.Message(other, anna, "@ivan 30 такси"))
+
+	stop := c.pollUntilStopped()
+	<-blocking.started
+	c.waitForReply(other.ID)
+	offset := stop()
+
+	if offset != stuck.UpdateID {
+		t.Errorf("serve returned offset %d, want the stuck update %d", offset, stuck.UpdateID)
+	}
+	offsets := c.server.Offsets()
+	for _, sent := range offsets {
+		if sent > stuck.UpdateID {
+			t.Errorf("getUpdates offsets %v confirm the stuck update %d", offsets, stuck.UpdateID)
+			break
+		}
+	}
+	if len(offsets) == 0 || offsets[len(offsets)-1] != stuck.UpdateID {
+		t.Errorf("getUpdates offsets %v, want the last one to stop at update %d", offsets, stuck.UpdateID)
+	}
+
+	// Let the abandoned update finish before the store is restored
+	close(blocking.release)
+	c.waitForReply(c.chat.ID)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/storage"
+)
+
+// rememberMessage records who wrote a message and, for groups, where, so that
+// /mybalance can find a user's chats by their user ID
+func rememberMessage(message *tgbotapi.Message) {
+	if message.From != nil && message.From.UserName != "" {
+		if err := store.SaveUsername(message.From.ID, message.From.UserName); err != nil {
+			log.Printf("Error saving username: %v", err)
+		}
+	}
+	if message.Chat == nil || message.Chat.IsPrivate() {
+		return
+	}
+	chat := storage.Chat{
+		ID:            message.Chat.ID,
+		Title:         message.Chat.Title,
+		Username:      message.Chat.UserName,
+		LastMessageID: message.MessageID,
+	}
+	if err := store.SaveChat(chat); err != nil {
+		log.Printf("Error saving chat: %v", err)
+	}
+}
+
+// handlePrivateMessage answers a direct message. Debts are recorded in
+// groups, so only commands about the user themselves work here.
+func handlePrivateMessage(bot telegramClient, message *tgbotapi.Message, lang i18n.Lang) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, "")
+	switch message.Command() {
+	case "mybalance":
+		msg.Text = renderDashboard(lang, message.From)
+	case "notify":
+		msg.Text = notifyCommand(message.From, message.CommandArguments(), lang)
+	case "lang":
+		msg.Text = langCommand(message.Chat.ID, message.CommandArguments(), lang)
+	case "start", "help":
+		msg.Text = renderHelp(lang)
+	default:
+		msg.Text = lang.T("private.only")
+	}
+	bot.Send(msg)
+}
+
+// renderDashboard sums up the balances of a user in every group chat they
+// share with the bot. The user is found by ID under every username they
+// have used, so renaming does not hide older debts.
+func renderDashboard(lang i18n.Lang, user *tgbotapi.User) string {
+	usernames, err := store.Usernames(user.ID)
+	if err != nil {
+		log.Printf("Error getting usernames: %v", err)
+		return lang.T("error.balance")
+	}
+	if user.UserName != "" && !containsString(usernames, user.UserName) {
+		usernames = append(usernames, user.UserName)
+	}
+	chats, err := store.UserChats(usernames)
+	if err != nil {
+		log.Printf("Error getting user chats: %v", err)
+		return lang.T("error.balance")
+	}
+
+	var response strings.Builder
+	total := 0
+	for _, chat := range chats {
+		today := dateOf(clock().In(getChatLocation(chat.ID)))
+		balances, err := chatLedger.Balances(chat.ID)
+		if err != nil {
+			log.Printf("Error calculating balances: %v", err)
+			return lang.T("error.balance")
+		}
+
+		net := 0
+		var lines []string
+		for _, balance := range balances {
+			isCreditor, isDebtor := containsString(usernames, balance.Creditor), containsString(usernames, balance.Debtor)
+			if isCreditor == isDebtor {
+				continue
+			}
+			if isCreditor {
+				net += balance.Amount
+			} else {
+				net -= balance.Amount
+			}
+			lines = append(lines, "• "+withDueDate(lang, describeBalance(lang, balance), balance, today))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		total += net
+
+		title := chat.Title
+		if title == "" {
+			title = lang.T("dashboard.untitled", chat.ID)
+		}
+		response.WriteString(fmt.Sprintf("\n%s: %s\n", title, formatSignedAmount(lang, net)))
+		response.WriteString(strings.Join(lines, "\n") + "\n")
+		if link := chatLink(chat); link != "" {
+			response.WriteString(link + "\n")
+		}
+	}
+
+	if response.Len() == 0 {
+		return lang.T("dashboard.none")
+	}
+	return lang.T("dashboard.total", formatSignedAmount(lang, total)) + "\n" + response.String()
+}
+
+// chatLink returns a link that opens a chat, or "" if it has none. Private
+// supergroups are opened at the latest message the bot has seen; basic
+// groups cannot be linked to.
+func chatLink(chat storage.Chat) string {
+	if chat.Username != "" {
+		return "https://t.me/" + chat.Username
+	}
+	// Supergroup IDs are -100 followed by the ID used in links
+	id := strconv.FormatInt(chat.ID, 10)
+	if !strings.HasPrefix(id, "-100") || chat.LastMessageID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%s/%d", strings.TrimPrefix(id, "-100"), chat.LastMessageID)
+}
+
+// formatSignedAmount formats a net position, e.g. "+50 рублей" when others owe the user
+func formatSignedAmount(lang i18n.Lang, amount int) string {
+	if amount > 0 {
+		return "+" + formatAmount(lang, amount)
+	}
+	return formatAmount(lang, amount)
+}
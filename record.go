@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// recordedEvent is a line of a recording: an incoming update, or the chat
+// administrators Telegram returned or a file the bot downloaded while the
+// previous update was handled
+type recordedEvent struct {
+	Update         *tgbotapi.Update        `json:"update,omitempty"`
+	Time           *time.Time              `json:"time,omitempty"` // when the update came in
+	Administrators *recordedAdministrators `json:"administrators,omitempty"`
+	File           *recordedFile           `json:"file,omitempty"`
+}
+
+type recordedAdministrators struct {
+	ChatID  int64                 `json:"chat_id"`
+	Members []tgbotapi.ChatMember `json:"members"`
+}
+
+type recordedFile struct {
+	FileID string `json:"file_id"`
+	Data   []byte `json:"data"`
+}
+
+// recorder appends the updates a bot receives to a JSON lines file for replay
+type recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// openRecorder opens a recording, appending to it if it exists
+func openRecorder(path string) (*recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *recorder) write(event recordedEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(event)
+}
+
+// recordUpdate writes an incoming update
+func (r *recorder) recordUpdate(update tgbotapi.Update) error {
+	now := clock()
+	return r.write(recordedEvent{Update: &update, Time: &now})
+}
+
+func (r *recorder) Close() error {
+	return r.file.Close()
+}
+
+// recordingClient records the answers of Bot API calls whose results the
+// handler depends on, so that a replay sees the same chat members and files
+type recordingClient struct {
+	telegramClient
+	recorder *recorder
+}
+
+func (c recordingClient) GetChatAdministrators(config tgbotapi.ChatAdministratorsConfig) ([]tgbotapi.ChatMember, error) {
+	members, err := c.telegramClient.GetChatAdministrators(config)
+	if err == nil {
+		c.recorder.write(recordedEvent{Administrators: &recordedAdministrators{ChatID: config.ChatID, Members: members}})
+	}
+	return members, err
+}
+
+func (c recordingClient) DownloadFile(fileID string) ([]byte, error) {
+	data, err := c.telegramClient.DownloadFile(fileID)
+	if err == nil {
+		c.recorder.write(recordedEvent{File: &recordedFile{FileID: fileID, Data: data}})
+	}
+	return data, err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/storage"
+)
+
+// recurringFrequencies maps the arguments of /recurring add to frequencies
+var recurringFrequencies = map[string]storage.Frequency{
+	"daily":   storage.Daily,
+	"weekly":  storage.Weekly,
+	"monthly": storage.Monthly,
+}
+
+// recurringCommand handles /recurring, which records a debt message on a
+// schedule on behalf of the user who added it:
+//
+//	/recurring add daily|weekly 1-7|monthly 1-31 <debt message>
+//	/recurring list
+//	/recurring pause|resume|delete <id>
+func recurringCommand(chatID int64, user, args string, lang i18n.Lang) string {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return lang.T("recurring.usage")
+	}
+	switch strings.ToLower(fields[0]) {
+	case "add":
+		return addRecurring(chatID, user, fields[1:], lang)
+	case "list":
+		return listRecurrings(chatID, lang)
+	case "pause", "resume", "delete":
+		if len(fields) != 2 {
+			return lang.T("recurring.usage")
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[1], "#"))
+		if err != nil {
+			return lang.T("recurring.usage")
+		}
+		return changeRecurring(chatID, user, strings.ToLower(fields[0]), id, lang)
+	default:
+		return lang.T("recurring.usage")
+	}
+}
+
+// addRecurring handles /recurring add
+func addRecurring(chatID int64, user string, fields []string, lang i18n.Lang) string {
+	if len(fields) < 2 {
+		return lang.T("recurring.usage")
+	}
+	frequency, ok := recurringFrequencies[strings.ToLower(fields[0])]
+	if !ok {
+		return lang.T("recurring.usage")
+	}
+	fields = fields[1:]
+
+	day := 0
+	if frequency != storage.Daily {
+		maxDay := 7
+		if frequency == storage.Monthly {
+			maxDay = 31
+		}
+		var err error
+		day, err = strconv.Atoi(fields[0])
+		if err != nil || day < 1 || day > maxDay {
+			return lang.T("recurring.day", maxDay)
+		}
+		fields = fields[1:]
+	}
+
+	text := strings.Join(fields, " ")
+	debt, ok := parseDebtMessage(text)
+	if !ok {
+		return lang.T("recurring.usage")
+	}
+	// A fixed due date would pass while the operation keeps recording debts
+	if !debt.Due.IsZero() {
+		return lang.T("recurring.due")
+	}
+	if user == "" {
+		return lang.T("notify.no_username")
+	}
+
+	now := clock().In(getChatLocation(chatID))
+	recurring := storage.Recurring{
+		ChatID:    chatID,
+		Author:    user,
+		Frequency: frequency,
+		Day:       day,
+		Text:      text,
+		NextRun:   firstRun(frequency, day, now),
+	}
+	id, err := store.AddRecurring(recurring)
+	if err != nil {
+		log.Printf("Error saving recurring operation: %v", err)
+		return lang.T("error.recurring")
+	}
+	return lang.T("recurring.added", id, describeSchedule(lang, frequency, day), text, recurring.NextRun.Format("02.01.2006 15:04"))
+}
+
+// listRecurrings handles /recurring list
+func listRecurrings(chatID int64, lang i18n.Lang) string {
+	recurrings, err := store.Recurrings(chatID)
+	if err != nil {
+		log.Printf("Error getting recurring operations: %v", err)
+		return lang.T("error.recurring")
+	}
+	if len(recurrings) == 0 {
+		return lang.T("recurring.none")
+	}
+
+	loc := getChatLocation(chatID)
+	var response strings.Builder
+	response.WriteString(lang.T("recurring.list") + "\n\n")
+	for _, recurring := range recurrings {
+		schedule := describeSchedule(lang, recurring.Frequency, recurring.Day)
+		if recurring.Paused {
+			response.WriteString(lang.T("recurring.item.paused", recurring.ID, schedule, recurring.Text, recurring.Author) + "\n")
+			continue
+		}
+		next := recurring.NextRun.In(loc).Format("02.01.2006 15:04")
+		response.WriteString(lang.T("recurring.item", recurring.ID, schedule, recurring.Text, recurring.Author, next) + "\n")
+	}
+	return response.String()
+}
+
+// changeRecurring pauses, resumes or deletes a recurring operation. Only its
+// author or a bot admin may change it.
+func changeRecurring(chatID int64, user, action string, id int, lang i18n.Lang) string {
+	recurrings, err := store.Recurrings(chatID)
+	if err != nil {
+		log.Printf("Error getting recurring operations: %v", err)
+		return lang.T("error.recurring")
+	}
+	var recurring *storage.Recurring
+	for i := range recurrings {
+		if recurrings[i].ID == id {
+			recurring = &recurrings[i]
+		}
+	}
+	if recurring == nil {
+		return lang.T("recurring.not_found", id)
+	}
+	if recurring.Author != user && !cfg.isAdmin(user) {
+		return lang.T("recurring.not_author", recurring.Author)
+	}
+
+	var key string
+	switch action {
+	case "delete":
+		_, err = store.DeleteRecurring(chatID, id)
+		key = "recurring.deleted"
+	case "pause":
+		recurring.Paused = true
+		_, err = store.UpdateRecurring(*recurring)
+		key = "recurring.paused"
+	case "resume":
+		// Runs missed while paused are skipped
+		recurring.Paused = false
+		recurring.NextRun = nextRunAfter(recurring.Frequency, recurring.Day, recurring.NextRun.In(getChatLocation(chatID)), clock())
+		_, err = store.UpdateRecurring(*recurring)
+		key = "recurring.resumed"
+	}
+	if err != nil {
+		log.Printf("Error changing recurring operation: %v", err)
+		return lang.T("error.recurring")
+	}
+	return lang.T(key, id)
+}
+
+// describeSchedule names when a recurring operation runs, e.g. "ежемесячно 1-го числа"
+func describeSchedule(lang i18n.Lang, frequency storage.Frequency, day int) string {
+	switch frequency {
+	case storage.Monthly:
+		return lang.T("schedule.monthly", day)
+	case storage.Weekly:
+		return lang.T(fmt.Sprintf("schedule.weekly.%d", day))
+	default:
+		return describeFrequency(lang, frequency)
+	}
+}
+
+// runRecurring records a recurring operation that was due at the given time
+// and tells the chat about it
+func runRecurring(bot telegramClient, recurring storage.Recurring, due time.Time) {
+	debt, ok := parseDebtMessage(recurring.Text)
+	if !ok {
+		log.Printf("Recurring operation %d is not a debt message: %q", recurring.ID, recurring.Text)
+		return
+	}
+	// Operations added before due dates were rejected may still carry one
+	if debt.Due.Before(dateOf(due)) {
+		log.Printf("Recurring operation %d: dropping due date %s that has passed", recurring.ID, formatDate(debt.Due))
+		debt.Due = time.Time{}
+	}
+	lang := getChatLang(recurring.ChatID)
+	reply := recordDebtMessage(bot, knownChat(recurring.ChatID), recurring.Author, debt, due, lang)
+	header := lang.T("recurring.ran", recurring.ID, recurring.Text, due.Format("02.01.2006"))
+	sendNotification(bot, recurring.ChatID, header+"\n"+reply)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// defaultReminderAge is how many days old a debt has to be to be listed by a
+// reminder when /remind on does not say
+const defaultReminderAge = 7
+
+// remindFrequencies maps the arguments of /remind on to frequencies
+var remindFrequencies = map[string]storage.Frequency{
+	"daily":  storage.Daily,
+	"weekly": storage.Weekly,
+}
+
+// remindCommand handles /remind, which shows, sets up or turns off the
+// periodic summary of old debts in a chat:
+//
+//	/remind on [daily|weekly] [days] [dm]
+//	/remind off
+func remindCommand(chatID int64, args string, lang i18n.Lang) string {
+	fields := strings.Fields(strings.ToLower(args))
+	if len(fields) == 0 {
+		reminder, err := store.Reminder(chatID)
+		if err == storage.ErrNotFound {
+			return lang.T("remind.off")
+		}
+		if err != nil {
+			log.Printf("Error getting reminder: %v", err)
+			return lang.T("error.remind")
+		}
+		return describeReminder(lang, reminder)
+	}
+
+	switch fields[0] {
+	case "off":
+		if err := store.DeleteReminder(chatID); err != nil {
+			log.Printf("Error deleting reminder: %v", err)
+			return lang.T("error.remind")
+		}
+		return lang.T("remind.off")
+	case "on":
+	default:
+		return lang.T("remind.usage")
+	}
+
+	reminder := storage.Reminder{ChatID: chatID, Frequency: storage.Weekly, MinAge: defaultReminderAge}
+	for _, field := range fields[1:] {
+		if frequency, ok := remindFrequencies[field]; ok {
+			reminder.Frequency = frequency
+			continue
+		}
+		if days, err := strconv.Atoi(field); err == nil && days >= 0 {
+			reminder.MinAge = days
+			continue
+		}
+		if field == "dm" {
+			reminder.Direct = true
+			continue
+		}
+		return lang.T("remind.usage")
+	}
+	// The first summary comes a whole period from now, at the same time of day
+	reminder.NextRun = nextRun(reminder.Frequency, 0, clock().In(getChatLocation(chatID)))
+	if err := store.SaveReminder(reminder); err != nil {
+		log.Printf("Error saving reminder: %v", err)
+		return lang.T("error.remind")
+	}
+	return describeReminder(lang, reminder)
+}
+
+// describeReminder sums up the reminder of a chat in a /remind reply
+func describeReminder(lang i18n.Lang, reminder storage.Reminder) string {
+	target := lang.T("remind.to_chat")
+	if reminder.Direct {
+		target = lang.T("remind.to_debtors")
+	}
+	next := reminder.NextRun.In(getChatLocation(reminder.ChatID)).Format("02.01.2006 15:04")
+	return lang.N("remind.on", reminder.MinAge, describeFrequency(lang, reminder.Frequency), reminder.MinAge, target, next)
+}
+
+// describeFrequency names how often a scheduled job runs
+func describeFrequency(lang i18n.Lang, frequency storage.Frequency) string {
+	return lang.T("frequency." + string(frequency))
+}
+
+// runReminder sends the summary of a chat's overdue debts and those older
+// than the reminder allows, to the chat or privately to every debtor.
+// Debtors who cannot be messaged privately are listed in the chat instead.
+// Nothing is sent when no debt is old enough or overdue.
+func runReminder(bot telegramClient, reminder storage.Reminder, now time.Time) {
+	balances, err := chatLedger.Balances(reminder.ChatID)
+	if err != nil {
+		log.Printf("Error calculating balances: %v", err)
+		return
+	}
+	loc := getChatLocation(reminder.ChatID)
+	cutoff, today := now.AddDate(0, 0, -reminder.MinAge), dateOf(now.In(loc))
+	var old []ledger.Balance
+	for _, balance := range balances {
+		if !balance.Since.After(cutoff) || balance.Overdue(today) {
+			old = append(old, balance)
+		}
+	}
+
+	if reminder.Direct {
+		old = remindDebtors(bot, reminder.ChatID, old, today)
+	}
+	if len(old) == 0 {
+		return
+	}
+
+	lang := getChatLang(reminder.ChatID)
+	var text strings.Builder
+	text.WriteString(lang.N("remind.title", reminder.MinAge, reminder.MinAge) + "\n\n")
+	for _, balance := range old {
+		text.WriteString("• " + describeAgedBalance(lang, balance, loc, today) + "\n")
+	}
+	sendNotification(bot, reminder.ChatID, text.String())
+}
+
+// remindDebtors sends every debtor who can be messaged privately their own
+// old debts and returns the balances of the debtors who cannot
+func remindDebtors(bot telegramClient, chatID int64, balances []ledger.Balance, today time.Time) []ledger.Balance {
+	var unreached []ledger.Balance
+	byDebtor := make(map[string][]ledger.Balance)
+	var debtors []string
+	for _, balance := range balances {
+		if _, seen := byDebtor[balance.Debtor]; !seen {
+			debtors = append(debtors, balance.Debtor)
+		}
+		byDebtor[balance.Debtor] = append(byDebtor[balance.Debtor], balance)
+	}
+
+	chat := knownChat(chatID)
+	for _, debtor := range debtors {
+		userID, err := store.UserID(debtor)
+		if err != nil {
+			log.Printf("Error getting user ID: %v", err)
+		}
+		mode := storage.NotifyUnset
+		if userID != 0 {
+			if mode, err = store.NotifyMode(userID); err != nil {
+				log.Printf("Error getting notification mode: %v", err)
+			}
+		}
+		if userID == 0 || mode == storage.NotifyMute {
+			unreached = append(unreached, byDebtor[debtor]...)
+			continue
+		}
+
+		lang := getChatLang(userID)
+		loc := getChatLocation(chatID)
+		var text strings.Builder
+		text.WriteString(lang.T("remind.direct", chatTitle(lang, chat)) + "\n")
+		for _, balance := range byDebtor[debtor] {
+			text.WriteString("• " + describeAgedBalance(lang, balance, loc, today) + "\n")
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(userID, text.String())); err != nil {
+			// Users who never started the bot cannot be messaged
+			log.Printf("Error reminding user %d: %v", userID, err)
+			unreached = append(unreached, byDebtor[debtor]...)
+		}
+	}
+	return unreached
+}
+
+// describeAgedBalance renders a balance with the date it is owed since and
+// its due date, e.g. "ivan должен anna 50 рублей, с 12.09.2026"
+func describeAgedBalance(lang i18n.Lang, balance ledger.Balance, loc *time.Location, today time.Time) string {
+	text := lang.T("remind.since", describeBalance(lang, balance), balance.Since.In(loc).Format("02.01.2006"))
+	return withDueDate(lang, text, balance, today)
+}
+
+// nudgeRe matches the argument of /nudge
+var nudgeRe = regexp.MustCompile(`^@(\w+)$`)
+
+// nudgeCommand handles /nudge @username, a one-off reminder to a user of
+// what they owe the sender. The reply mentions them, so Telegram notifies them.
+func nudgeCommand(chatID int64, from, args string, lang i18n.Lang) string {
+	match := nudgeRe.FindStringSubmatch(strings.TrimSpace(args))
+	if match == nil || match[1] == from {
+		return lang.T("nudge.usage")
+	}
+	debtor := match[1]
+
+	balances, err := chatLedger.Balances(chatID)
+	if err != nil {
+		log.Printf("Error calculating balances: %v", err)
+		return lang.T("error.balance")
+	}
+	loc := getChatLocation(chatID)
+	today := dateOf(clock().In(loc))
+	for _, balance := range balances {
+		if balance.Debtor == debtor && balance.Creditor == from {
+			return lang.T("nudge.text", debtor, from, describeAgedBalance(lang, balance, loc, today))
+		}
+	}
+	return lang.G("nudge.none", i18n.Gender(getUserGender(debtor)), debtor)
+}
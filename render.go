@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"obshyakBot3/i18n"
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+)
+
+// owes describes a debt in the grammatical gender of the debtor, e.g.
+// "ivan должен anna 50 рублей" or "ivan — долг перед anna 50 рублей"
+func owes(lang i18n.Lang, debtor, creditor string, amount int) string {
+	return lang.G("owes", i18n.Gender(getUserGender(debtor)), debtor, creditor, formatAmount(lang, amount))
+}
+
+// returned describes a repayment in the grammatical gender of the payer, e.g.
+// "anna вернула ivan 50 рублей" or "anna — возврат ivan 50 рублей"
+func returned(lang i18n.Lang, payer, recipient string, amount int) string {
+	return lang.G("returned", i18n.Gender(getUserGender(payer)), payer, recipient, formatAmount(lang, amount))
+}
+
+// describeEntry renders a ledger entry with its reason and due date, e.g.
+// "ivan должен anna 50 рублей обед, вернуть до 01.11.2026"
+func describeEntry(lang i18n.Lang, entry storage.Entry) string {
+	var text string
+	if entry.Type == storage.TypeReturn {
+		text = returned(lang, entry.From, entry.To, entry.Amount)
+	} else {
+		text = owes(lang, entry.To, entry.From, entry.Amount)
+	}
+	if entry.Reason != "" {
+		text += " " + entry.Reason
+	}
+	if !entry.Due.IsZero() {
+		text = lang.T("due", text, formatDate(entry.Due))
+	}
+	return text
+}
+
+// describeBalance renders an outstanding balance, e.g. "ivan должен anna 50 рублей"
+func describeBalance(lang i18n.Lang, balance ledger.Balance) string {
+	return owes(lang, balance.Debtor, balance.Creditor, balance.Amount)
+}
+
+// withDueDate adds the due date of a balance to its description, marking
+// it once today is past the date
+func withDueDate(lang i18n.Lang, text string, balance ledger.Balance, today time.Time) string {
+	switch {
+	case balance.Overdue(today):
+		return lang.T("overdue", text, formatDate(balance.Due))
+	case !balance.Due.IsZero():
+		return lang.T("due", text, formatDate(balance.Due))
+	default:
+		return text
+	}
+}
+
+// formatDate formats a calendar day such as a due date, e.g. 01.11.2026
+func formatDate(day time.Time) string {
+	return day.Format("02.01.2006")
+}
+
+// describeShare renders what a split meant for one debtor, e.g.
+// "anna вернула ivan 20 рублей и теперь ivan должен anna 30 рублей"
+func describeShare(lang i18n.Lang, payer string, share ledger.Share) string {
+	switch {
+	case share.Returned > 0 && share.Owed > 0:
+		return lang.T("returned_and_owes",
+			returned(lang, payer, share.Debtor, share.Returned), owes(lang, share.Debtor, payer, share.Owed))
+	case share.Returned > 0:
+		return returned(lang, payer, share.Debtor, share.Returned)
+	default:
+		return owes(lang, share.Debtor, payer, share.Owed)
+	}
+}
+
+// writeRecorded appends a line per share of a recorded split and its category to a reply
+func writeRecorded(response *strings.Builder, lang i18n.Lang, payer string, recorded ledger.Recorded) {
+	for _, share := range recorded.Shares {
+		response.WriteString(describeShare(lang, payer, share) + "\n")
+	}
+	if !recorded.Due.IsZero() {
+		response.WriteString(lang.T("recorded.due", formatDate(recorded.Due)) + "\n")
+	}
+	if recorded.Category != "" {
+		response.WriteString(lang.T("recorded.category", recorded.Category) + "\n")
+	}
+}
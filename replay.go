@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"obshyakBot3/ledger"
+	"obshyakBot3/storage"
+	"obshyakBot3/telegramtest"
+)
+
+// maxRecordedLine limits the size of a single recorded event
+const maxRecordedLine = 16 << 20
+
+// runReplay implements the replay subcommand: it feeds a recording made with
+// -record into the handler against a fresh in-memory database and prints the
+// conversation, or compares it with an expected transcript.
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	expect := flags.String("expect", "", "compare the transcript with this file and print the differences")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [-expect transcript.txt] updates.jsonl\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	events, err := readRecording(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading recording: %v\n", err)
+		return 1
+	}
+
+	store = storage.OpenMemory()
+	chatLedger = ledger.New(store)
+	if err := importLegacyWomen(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying women: %v\n", err)
+		return 1
+	}
+	server := telegramtest.NewServer()
+	defer server.Close()
+	api, err := server.NewBot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting fake Bot API: %v\n", err)
+		return 1
+	}
+	bot := newBotClient(api, server.Endpoint())
+	// File IDs are unique, so every downloaded file can be served from the start
+	for _, event := range events {
+		if event.File != nil {
+			server.SetFile(event.File.FileID, event.File.Data)
+		}
+	}
+
+	// Handlers see the time each update came in, so that the replay does not
+	// depend on when it runs
+	defer func() { clock = time.Now }()
+	var now time.Time
+	var transcript strings.Builder
+	for i, event := range events {
+		if event.Update == nil {
+			continue
+		}
+		now = updateTime(event, now)
+		at := now
+		clock = func() time.Time { return at }
+		// Administrators of the chat recorded before its next update were
+		// fetched while handling this one. Other chats' events may come in
+		// between, as chats are handled in parallel.
+		chatID := updateChatID(*event.Update)
+		for _, next := range events[i+1:] {
+			if next.Update != nil && updateChatID(*next.Update) == chatID {
+				break
+			}
+			if next.Administrators == nil || next.Administrators.ChatID != chatID {
+				continue
+			}
+			var users []tgbotapi.User
+			for _, member := range next.Administrators.Members {
+				if member.User != nil {
+					users = append(users, *member.User)
+				}
+			}
+			server.SetAdministrators(next.Administrators.ChatID, users...)
+		}
+
+		server.Reset()
+		handleUpdate(bot, *event.Update)
+		writeTranscript(&transcript, *event.Update, server.Calls())
+	}
+
+	if *expect == "" {
+		fmt.Print(transcript.String())
+		return 0
+	}
+	want, err := os.ReadFile(*expect)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading expected transcript: %v\n", err)
+		return 1
+	}
+	diff := diffLines(strings.Split(string(want), "\n"), strings.Split(transcript.String(), "\n"))
+	if diff == nil {
+		return 0
+	}
+	fmt.Println(strings.Join(diff, "\n"))
+	return 1
+}
+
+// updateTime returns when a recorded update came in. Recordings made before
+// that was kept give the date of the message, and callback queries in them
+// the time of the update before.
+func updateTime(event recordedEvent, previous time.Time) time.Time {
+	switch {
+	case event.Time != nil:
+		return *event.Time
+	case event.Update.Message != nil:
+		return event.Update.Message.Time()
+	case previous.IsZero():
+		return time.Now()
+	default:
+		return previous
+	}
+}
+
+// readRecording reads the events of a recording made with -record
+func readRecording(path string) ([]recordedEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []recordedEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxRecordedLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event recordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// writeTranscript describes an update and the messages the bot sent in response
+func writeTranscript(w io.Writer, update tgbotapi.Update, calls []telegramtest.Call) {
+	switch {
+	case update.Message != nil:
+		message := update.Message
+		text := message.Text
+		if message.Document != nil {
+			text = fmt.Sprintf("(document %s) %s", message.Document.FileName, message.Caption)
+		}
+		fmt.Fprintf(w, "[%d] %s: %s\n", message.Chat.ID, message.From.UserName, text)
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		query := update.CallbackQuery
+		fmt.Fprintf(w, "[%d] %s pressed %q\n", query.Message.Chat.ID, query.From.UserName, query.Data)
+	default:
+		return
+	}
+
+	for _, call := range calls {
+		switch call.Method {
+		case "sendMessage", "sendPhoto", "sendDocument", "editMessageText":
+			text := strings.TrimRight(call.Text(), "\n")
+			fmt.Fprintf(w, "  %s: %s\n", call.Method, strings.ReplaceAll(text, "\n", "\n    "))
+		}
+	}
+}
+
+// diffLines returns a line diff turning want into got with - and + markers,
+// or nil if they are equal
+func diffLines(want, got []string) []string {
+	// common[i][j] is the length of the longest common subsequence of want[i:] and got[j:]
+	common := make([][]int, len(want)+1)
+	for i := range common {
+		common[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	changed := false
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			diff = append(diff, "  "+want[i])
+			i++
+			j++
+		case i < len(want) && (j == len(got) || common[i+1][j] >= common[i][j+1]):
+			diff = append(diff, "- "+want[i])
+			changed = true
+			i++
+		default:
+			diff = append(diff, "+ "+got[j])
+			changed = true
+			j++
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return diff
+}
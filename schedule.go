@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+// schedulerInterval is how often the scheduler looks for due jobs
+const schedulerInterval = time.Minute
+
+// runScheduler runs the reminders and recurring operations that are due,
+// once at start and then every minute until ctx is done. Schedules are kept
+// in the store, so jobs missed while the bot was down run as soon as it is
+// back. Jobs run on the workers of their chats.
+func runScheduler(ctx context.Context, bot telegramClient, workers *dispatcher) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	runDueJobs(bot, workers, clock())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runDueJobs(bot, workers, now)
+		}
+	}
+}
+
+// runDueJobs queues every job due at now on the worker of its chat
+func runDueJobs(bot telegramClient, workers *dispatcher, now time.Time) {
+	runDueRecurrings(bot, workers, now)
+
+	reminders, err := store.DueReminders(now)
+	if err != nil {
+		log.Printf("Error getting due reminders: %v", err)
+		return
+	}
+	for _, reminder := range reminders {
+		// Move the reminder on first, so a failing run is not repeated every minute
+		reminder.NextRun = nextRunAfter(reminder.Frequency, 0, reminder.NextRun.In(getChatLocation(reminder.ChatID)), now)
+		if err := store.SaveReminder(reminder); err != nil {
+			log.Printf("Error saving reminder: %v", err)
+			continue
+		}
+		reminder := reminder
+		workers.run(reminder.ChatID, func() { runReminder(bot, reminder, now) })
+	}
+}
+
+// runDueRecurrings records the recurring operations due at now. Unlike
+// reminders, every run missed while the bot was down is recorded, each at
+// the time it was due and in the order they were due.
+func runDueRecurrings(bot telegramClient, workers *dispatcher, now time.Time) {
+	for {
+		recurrings, err := store.DueRecurrings(now)
+		if err != nil {
+			log.Printf("Error getting due recurring operations: %v", err)
+			return
+		}
+		if len(recurrings) == 0 {
+			return
+		}
+		for _, recurring := range recurrings {
+			due := recurring.NextRun.In(getChatLocation(recurring.ChatID))
+			// Move the operation on first, so that no run is recorded twice
+			recurring.NextRun = nextRun(recurring.Frequency, recurring.Day, due)
+			ok, err := store.UpdateRecurring(recurring)
+			if err != nil {
+				log.Printf("Error saving recurring operation: %v", err)
+				return
+			}
+			if ok {
+				recurring := recurring
+				workers.run(recurring.ChatID, func() { runRecurring(bot, recurring, due) })
+			}
+		}
+	}
+}
+
+// nextRun returns when a job that last ran at t runs next. Monthly jobs run
+// on day of the month, or on its last day in shorter months. Days are
+// counted in the zone of t, so the time of day stays the same across DST
+// changes.
+func nextRun(frequency storage.Frequency, day int, t time.Time) time.Time {
+	switch frequency {
+	case storage.Monthly:
+		next := time.Date(t.Year(), t.Month()+1, 1, t.Hour(), t.Minute(), 0, 0, t.Location())
+		return next.AddDate(0, 0, min(day, daysInMonth(next))-1)
+	case storage.Weekly:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// nextRunAfter returns the first run of a job scheduled at t that comes
+// after now. Runs missed in between are skipped.
+func nextRunAfter(frequency storage.Frequency, day int, t, now time.Time) time.Time {
+	for !t.After(now) {
+		t = nextRun(frequency, day, t)
+	}
+	return t
+}
+
+// firstRun returns the first run after now of a job that runs on day at the
+// time of day of now. Daily jobs run first a day from now.
+func firstRun(frequency storage.Frequency, day int, now time.Time) time.Time {
+	switch frequency {
+	case storage.Monthly:
+		first := time.Date(now.Year(), now.Month(), min(day, daysInMonth(now)), now.Hour(), now.Minute(), 0, 0, now.Location())
+		return nextRunAfter(frequency, day, first, now)
+	case storage.Weekly:
+		first := time.Date(now.Year(), now.Month(), now.Day()+1, now.Hour(), now.Minute(), 0, 0, now.Location())
+		for isoWeekday(first) != day {
+			first = first.AddDate(0, 0, 1)
+		}
+		return first
+	default:
+		return nextRun(frequency, day, now)
+	}
+}
+
+// daysInMonth returns the number of days in the month of t
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// isoWeekday numbers the days of the week from 1 for Monday to 7 for Sunday
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
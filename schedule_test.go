@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+func TestNextRun(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	tests := []struct {
+		name      string
+		frequency storage.Frequency
+		day       int
+		t         time.Time
+		want      time.Time
+	}{
+		{"daily", storage.Daily, 0, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 11, 9, time.UTC)},
+		{"weekly", storage.Weekly, 7, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 17, 9, time.UTC)},
+		{"monthly", storage.Monthly, 15, date(2024, 3, 15, 9, time.UTC), date(2024, 4, 15, 9, time.UTC)},
+		{"31st into February", storage.Monthly, 31, date(2024, 1, 31, 9, time.UTC), date(2024, 2, 29, 9, time.UTC)},
+		{"31st into February of a common year", storage.Monthly, 31, date(2023, 1, 31, 9, time.UTC), date(2023, 2, 28, 9, time.UTC)},
+		{"31st after February", storage.Monthly, 31, date(2024, 2, 29, 9, time.UTC), date(2024, 3, 31, 9, time.UTC)},
+		{"31st into April", storage.Monthly, 31, date(2024, 3, 31, 9, time.UTC), date(2024, 4, 30, 9, time.UTC)},
+		{"December into January", storage.Monthly, 1, date(2024, 12, 1, 9, time.UTC), date(2025, 1, 1, 9, time.UTC)},
+		{"daily across DST", storage.Daily, 0, date(2024, 3, 30, 9, berlin), date(2024, 3, 31, 9, berlin)},
+		{"weekly across DST", storage.Weekly, 6, date(2024, 10, 26, 9, berlin), date(2024, 11, 2, 9, berlin)},
+		{"monthly across DST", storage.Monthly, 15, date(2024, 3, 15, 9, berlin), date(2024, 4, 15, 9, berlin)},
+	}
+	for _, test := range tests {
+		if got := nextRun(test.frequency, test.day, test.t); !got.Equal(test.want) {
+			t.Errorf("%s: nextRun(%s) = %s, want %s", test.name, test.t, got, test.want)
+		}
+	}
+}
+
+func TestNextRunAfter(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency storage.Frequency
+		day       int
+		t, now    time.Time
+		want      time.Time
+	}{
+		{"not due yet", storage.Daily, 0, date(2024, 3, 12, 9, time.UTC), date(2024, 3, 10, 9, time.UTC), date(2024, 3, 12, 9, time.UTC)},
+		{"due now", storage.Daily, 0, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 10, 9, time.UTC), date(2024, 3, 11, 9, time.UTC)},
+		{"missed runs today", storage.Daily, 0, date(2024, 3, 7, 9, time.UTC), date(2024, 3, 10, 8, time.UTC), date(2024, 3, 10, 9, time.UTC)},
+		{"missed runs tomorrow", storage.Daily, 0, date(2024, 3, 7, 9, time.UTC), date(2024, 3, 10, 10, time.UTC), date(2024, 3, 11, 9, time.UTC)},
+		{"missed weeks", storage.Weekly, 1, date(2024, 3, 4, 9, time.UTC), date(2024, 3, 20, 9, time.UTC), date(2024, 3, 25, 9, time.UTC)},
+		{"missed months keep the 31st", storage.Monthly, 31, date(2024, 1, 31, 9, time.UTC), date(2024, 4, 1, 9, time.UTC), date(2024, 4, 30, 9, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := nextRunAfter(test.frequency, test.day, test.t, test.now); !got.Equal(test.want) {
+			t.Errorf("%s: nextRunAfter(%s, %s) = %s, want %s", test.name, test.t, test.now, got, test.want)
+		}
+	}
+}
+
+func TestFirstRun(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	tests := []struct {
+		name      string
+		frequency storage.Frequency
+		day       int
+		now       time.Time
+		want      time.Time
+	}{
+		{"daily", storage.Daily, 0, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 11, 9, time.UTC)},
+		{"weekly on Monday from Sunday", storage.Weekly, 1, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 11, 9, time.UTC)},
+		{"weekly on Monday from Monday", storage.Weekly, 1, date(2024, 3, 11, 9, time.UTC), date(2024, 3, 18, 9, time.UTC)},
+		{"weekly on Sunday from Monday", storage.Weekly, 7, date(2024, 3, 11, 9, time.UTC), date(2024, 3, 17, 9, time.UTC)},
+		{"monthly later this month", storage.Monthly, 20, date(2024, 3, 10, 9, time.UTC), date(2024, 3, 20, 9, time.UTC)},
+		{"monthly earlier this month", storage.Monthly, 5, date(2024, 3, 10, 9, time.UTC), date(2024, 4, 5, 9, time.UTC)},
+		{"monthly on today", storage.Monthly, 10, date(2024, 3, 10, 9, time.UTC), date(2024, 4, 10, 9, time.UTC)},
+		{"31st in February", storage.Monthly, 31, date(2024, 2, 10, 9, time.UTC), date(2024, 2, 29, 9, time.UTC)},
+		{"31st on the last day of February", storage.Monthly, 31, date(2024, 2, 29, 9, time.UTC), date(2024, 3, 31, 9, time.UTC)},
+		{"daily across DST", storage.Daily, 0, date(2024, 3, 30, 9, berlin), date(2024, 3, 31, 9, berlin)},
+		{"weekly across DST", storage.Weekly, 1, date(2024, 3, 28, 9, berlin), date(2024, 4, 1, 9, berlin)},
+	}
+	for _, test := range tests {
+		if got := firstRun(test.frequency, test.day, test.now); !got.Equal(test.want) {
+			t.Errorf("%s: firstRun(%s) = %s, want %s", test.name, test.now, got, test.want)
+		}
+	}
+}
+
+func date(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, loc)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	return loc
+}
@@ -0,0 +1,671 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps the ledger in process memory. It is lost on exit and is
+// meant for tests and throwaway demo runs.
+type memoryStore struct {
+	mu         sync.Mutex
+	entries    []Entry // in insertion order
+	lastOpID   int
+	tags       map[operationKey][]string
+	categories map[operationKey]string
+	timezones  map[int64]string
+	languages  map[int64]string
+	genders    map[string]Gender
+	chats      map[int64]Chat
+	userIDs    map[string]int64 // owner of every username
+	notify     map[int64]NotifyMode
+	queued     []queuedNotification
+	reminders  map[int64]Reminder
+	recurring  []Recurring // ordered by ID
+	lastRecID  int
+}
+
+// queuedNotification is a notification waiting for a digest
+type queuedNotification struct {
+	UserID int64
+	Text   string
+}
+
+// operationKey identifies an operation within a chat
+type operationKey struct {
+	ChatID      int64
+	OperationID int
+}
+
+// OpenMemory returns an empty in-memory store
+func OpenMemory() Store {
+	return &memoryStore{
+		tags:       make(map[operationKey][]string),
+		categories: make(map[operationKey]string),
+		timezones:  make(map[int64]string),
+		languages:  make(map[int64]string),
+		genders:    make(map[string]Gender),
+		chats:      make(map[int64]Chat),
+		userIDs:    make(map[string]int64),
+		notify:     make(map[int64]NotifyMode),
+		reminders:  make(map[int64]Reminder),
+	}
+}
+
+func (s *memoryStore) SaveOperation(op Operation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveOperation(op), nil
+}
+
+func (s *memoryStore) SaveOperations(ops []Operation) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for _, op := range ops {
+		ids = append(ids, s.saveOperation(op))
+	}
+	return ids, nil
+}
+
+// saveOperation records an operation and returns its new ID; s.mu must be held
+func (s *memoryStore) saveOperation(op Operation) int {
+	s.lastOpID++
+	for _, entry := range op.Entries {
+		entry.OperationID = s.lastOpID
+		entry.ChatID = op.ChatID
+		if entry.Type == "" {
+			entry.Type = TypeDebt
+		}
+		// Match the precision and zone of timestamps read back from SQLite
+		entry.Time = entry.Time.UTC().Truncate(time.Second)
+		entry.Due = entry.Due.UTC().Truncate(time.Second)
+		s.entries = append(s.entries, entry)
+	}
+
+	key := operationKey{op.ChatID, s.lastOpID}
+	if len(op.Tags) > 0 {
+		s.tags[key] = append([]string(nil), op.Tags...)
+	}
+	if op.Category != "" {
+		s.categories[key] = op.Category
+	}
+	return s.lastOpID
+}
+
+// chatEntries returns the indexes of a chat's entries from since on in insertion order
+func (s *memoryStore) chatEntries(chatID int64, since time.Time) []int {
+	since = since.Truncate(time.Second)
+	var indexes []int
+	for i, entry := range s.entries {
+		if entry.ChatID == chatID && !entry.Time.Before(since) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// repayment reports whether an operation of a chat is categorized as a repayment
+func (s *memoryStore) repayment(chatID int64, operationID int) bool {
+	return s.categories[operationKey{chatID, operationID}] == RepaymentCategory
+}
+
+func (s *memoryStore) NetBalance(chatID int64, a, b string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	net := 0
+	for _, i := range s.chatEntries(chatID, time.Time{}) {
+		entry := s.entries[i]
+		switch {
+		case entry.From == a && entry.To == b:
+			net += entry.Amount
+		case entry.From == b && entry.To == a:
+			net -= entry.Amount
+		}
+	}
+	return net, nil
+}
+
+func (s *memoryStore) Entries(chatID int64, since time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := s.chatEntries(chatID, since)
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := s.entries[indexes[i]], s.entries[indexes[j]]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.OperationID < b.OperationID
+	})
+	return s.collect(indexes), nil
+}
+
+// collect copies the entries at the given indexes
+func (s *memoryStore) collect(indexes []int) []Entry {
+	var entries []Entry
+	for _, i := range indexes {
+		entries = append(entries, s.entries[i])
+	}
+	return entries
+}
+
+// hasTag reports whether an operation is tagged with tag
+func (s *memoryStore) hasTag(key operationKey, tag string) bool {
+	for _, t := range s.tags[key] {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) History(chatID int64, filter HistoryFilter, offset, limit int) ([]Entry, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var indexes []int
+	for _, i := range s.chatEntries(chatID, filter.Since) {
+		entry := s.entries[i]
+		switch {
+		case !filter.Until.IsZero() && !entry.Time.Before(filter.Until.Truncate(time.Second)):
+			continue
+		case filter.User != "" && entry.From != filter.User && entry.To != filter.User:
+			continue
+		case filter.Tag != "" && !s.hasTag(operationKey{chatID, entry.OperationID}, filter.Tag):
+			continue
+		case filter.Type != "" && entry.Type != filter.Type:
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := s.entries[indexes[i]], s.entries[indexes[j]]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.After(b.Time)
+		}
+		return indexes[i] > indexes[j]
+	})
+
+	total := len(indexes)
+	if offset > total {
+		offset = total
+	}
+	indexes = indexes[offset:]
+	if limit < len(indexes) {
+		indexes = indexes[:limit]
+	}
+	return s.collect(indexes), total, nil
+}
+
+func (s *memoryStore) LastOperation(chatID int64) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op := Operation{ChatID: chatID}
+	for _, i := range s.chatEntries(chatID, time.Time{}) {
+		if s.entries[i].OperationID > op.ID {
+			op.ID = s.entries[i].OperationID
+			op.Author = s.entries[i].From
+		}
+	}
+	if op.ID == 0 {
+		return op, ErrNotFound
+	}
+
+	key := operationKey{chatID, op.ID}
+	for _, entry := range s.entries {
+		if entry.ChatID == chatID && entry.OperationID == op.ID {
+			op.Entries = append(op.Entries, entry)
+		}
+	}
+	op.Tags = append([]string(nil), s.tags[key]...)
+	op.Category = s.categories[key]
+	return op, nil
+}
+
+func (s *memoryStore) CancelOperation(chatID int64, operationID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.entries[:0]
+	deleted := 0
+	for _, entry := range s.entries {
+		if entry.ChatID == chatID && entry.OperationID == operationID {
+			deleted++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	s.entries = entries
+
+	key := operationKey{chatID, operationID}
+	delete(s.tags, key)
+	delete(s.categories, key)
+	return deleted, nil
+}
+
+func (s *memoryStore) Members(chatID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var members []string
+	for _, i := range s.chatEntries(chatID, time.Time{}) {
+		for _, member := range []string{s.entries[i].From, s.entries[i].To} {
+			if !seen[member] {
+				seen[member] = true
+				members = append(members, member)
+			}
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (s *memoryStore) CategoryTotals(chatID int64, since time.Time) ([]CategoryTotal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byCategory := make(map[string]*CategoryTotal)
+	operations := make(map[string]map[int]bool)
+	var totals []*CategoryTotal
+	for _, i := range s.chatEntries(chatID, since) {
+		entry := s.entries[i]
+		category, ok := s.categories[operationKey{chatID, entry.OperationID}]
+		if !ok {
+			category = DefaultCategory
+		}
+		if s.repayment(chatID, entry.OperationID) {
+			continue
+		}
+		total := byCategory[category]
+		if total == nil {
+			total = &CategoryTotal{Category: category}
+			byCategory[category] = total
+			operations[category] = make(map[int]bool)
+			totals = append(totals, total)
+		}
+		total.Amount += entry.Amount
+		operations[category][entry.OperationID] = true
+		total.Operations = len(operations[category])
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].Amount > totals[j].Amount
+	})
+
+	var result []CategoryTotal
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	return result, nil
+}
+
+func (s *memoryStore) MemberStats(chatID int64, since time.Time) ([]MemberStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byMember := make(map[string]*MemberStats)
+	member := func(name string) *MemberStats {
+		if byMember[name] == nil {
+			byMember[name] = &MemberStats{User: name}
+		}
+		return byMember[name]
+	}
+	for _, i := range s.chatEntries(chatID, since) {
+		entry := s.entries[i]
+		if s.repayment(chatID, entry.OperationID) {
+			continue
+		}
+		member(entry.From).Paid += entry.Amount
+		member(entry.To).Consumed += entry.Amount
+	}
+
+	var stats []MemberStats
+	for _, stat := range byMember {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Net() != stats[j].Net() {
+			return stats[i].Net() > stats[j].Net()
+		}
+		return stats[i].User < stats[j].User
+	})
+	return stats, nil
+}
+
+func (s *memoryStore) LargestExpenses(chatID int64, since time.Time, limit int) ([]Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type expenseKey struct {
+		OperationID int
+		From        string
+	}
+	byKey := make(map[expenseKey]*Expense)
+	var expenses []*Expense
+	for _, i := range s.chatEntries(chatID, since) {
+		entry := s.entries[i]
+		if s.repayment(chatID, entry.OperationID) {
+			continue
+		}
+		key := expenseKey{entry.OperationID, entry.From}
+		expense := byKey[key]
+		if expense == nil {
+			expense = &Expense{OperationID: entry.OperationID, From: entry.From, Time: entry.Time}
+			byKey[key] = expense
+			expenses = append(expenses, expense)
+		}
+		expense.Amount += entry.Amount
+		if entry.Reason > expense.Reason {
+			expense.Reason = entry.Reason
+		}
+		if entry.Time.Before(expense.Time) {
+			expense.Time = entry.Time
+		}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool {
+		if expenses[i].Amount != expenses[j].Amount {
+			return expenses[i].Amount > expenses[j].Amount
+		}
+		return expenses[i].OperationID > expenses[j].OperationID
+	})
+
+	var result []Expense
+	for _, expense := range expenses {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, *expense)
+	}
+	return result, nil
+}
+
+func (s *memoryStore) BusiestDays(chatID int64, since time.Time, loc *time.Location, limit int) ([]DayStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []Entry
+	for _, i := range s.chatEntries(chatID, since) {
+		if !s.repayment(chatID, s.entries[i].OperationID) {
+			entries = append(entries, s.entries[i])
+		}
+	}
+	return busiestDays(entries, loc, limit), nil
+}
+
+func (s *memoryStore) ChatTimezone(chatID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timezones[chatID], nil
+}
+
+func (s *memoryStore) SetChatTimezone(chatID int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timezones[chatID] = name
+	return nil
+}
+
+func (s *memoryStore) ChatLanguage(chatID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.languages[chatID], nil
+}
+
+func (s *memoryStore) SetChatLanguage(chatID int64, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.languages[chatID] = code
+	return nil
+}
+
+func (s *memoryStore) SaveChat(chat Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats[chat.ID] = chat
+	return nil
+}
+
+func (s *memoryStore) Chat(chatID int64) (Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chat, ok := s.chats[chatID]
+	if !ok {
+		return Chat{}, ErrNotFound
+	}
+	return chat, nil
+}
+
+func (s *memoryStore) UserChats(usernames []string) ([]Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+	seen := make(map[int64]bool)
+	var chats []Chat
+	for _, entry := range s.entries {
+		chat, known := s.chats[entry.ChatID]
+		if !known || seen[entry.ChatID] || !(wanted[entry.From] || wanted[entry.To]) {
+			continue
+		}
+		seen[entry.ChatID] = true
+		chats = append(chats, chat)
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		if chats[i].Title != chats[j].Title {
+			return chats[i].Title < chats[j].Title
+		}
+		return chats[i].ID < chats[j].ID
+	})
+	return chats, nil
+}
+
+func (s *memoryStore) SaveUsername(userID int64, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userIDs[username] = userID
+	return nil
+}
+
+func (s *memoryStore) Usernames(userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var usernames []string
+	for username, id := range s.userIDs {
+		if id == userID {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+func (s *memoryStore) UserID(username string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userIDs[username], nil
+}
+
+func (s *memoryStore) NotifyMode(userID int64) (NotifyMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notify[userID], nil
+}
+
+func (s *memoryStore) SetNotifyMode(userID int64, mode NotifyMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify[userID] = mode
+	return nil
+}
+
+func (s *memoryStore) QueueNotification(userID int64, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = append(s.queued, queuedNotification{UserID: userID, Text: text})
+	return nil
+}
+
+func (s *memoryStore) TakeNotifications() (map[int64][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notifications := make(map[int64][]string)
+	for _, queued := range s.queued {
+		notifications[queued.UserID] = append(notifications[queued.UserID], queued.Text)
+	}
+	s.queued = nil
+	return notifications, nil
+}
+
+func (s *memoryStore) DropNotifications(userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []queuedNotification
+	for _, queued := range s.queued {
+		if queued.UserID != userID {
+			kept = append(kept, queued)
+		}
+	}
+	s.queued = kept
+	return nil
+}
+
+func (s *memoryStore) Reminder(chatID int64) (Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminder, ok := s.reminders[chatID]
+	if !ok {
+		return Reminder{}, ErrNotFound
+	}
+	return reminder, nil
+}
+
+func (s *memoryStore) SaveReminder(reminder Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reminders[reminder.ChatID] = reminder
+	return nil
+}
+
+func (s *memoryStore) DeleteReminder(chatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reminders, chatID)
+	return nil
+}
+
+func (s *memoryStore) DueReminders(now time.Time) ([]Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Reminder
+	for _, reminder := range s.reminders {
+		if !reminder.NextRun.After(now) {
+			due = append(due, reminder)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextRun.Equal(due[j].NextRun) {
+			return due[i].NextRun.Before(due[j].NextRun)
+		}
+		return due[i].ChatID < due[j].ChatID
+	})
+	return due, nil
+}
+
+func (s *memoryStore) AddRecurring(recurring Recurring) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRecID++
+	recurring.ID = s.lastRecID
+	s.recurring = append(s.recurring, recurring)
+	return recurring.ID, nil
+}
+
+func (s *memoryStore) Recurrings(chatID int64) ([]Recurring, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var recurrings []Recurring
+	for _, recurring := range s.recurring {
+		if recurring.ChatID == chatID {
+			recurrings = append(recurrings, recurring)
+		}
+	}
+	return recurrings, nil
+}
+
+func (s *memoryStore) UpdateRecurring(recurring Recurring) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, stored := range s.recurring {
+		if stored.ChatID == recurring.ChatID && stored.ID == recurring.ID {
+			s.recurring[i].Paused = recurring.Paused
+			s.recurring[i].NextRun = recurring.NextRun
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) DeleteRecurring(chatID int64, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, recurring := range s.recurring {
+		if recurring.ChatID == chatID && recurring.ID == id {
+			s.recurring = append(s.recurring[:i], s.recurring[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) DueRecurrings(now time.Time) ([]Recurring, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Recurring
+	for _, recurring := range s.recurring {
+		if !recurring.Paused && !recurring.NextRun.After(now) {
+			due = append(due, recurring)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextRun.Before(due[j].NextRun)
+	})
+	return due, nil
+}
+
+func (s *memoryStore) UserGender(username string) (Gender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.genders[username], nil
+}
+
+func (s *memoryStore) SetUserGender(username string, gender Gender) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.genders[username] = gender
+	return nil
+}
+
+// Migrate does nothing, an in-memory store has no schema
+func (s *memoryStore) Migrate(dryRun bool) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
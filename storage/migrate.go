@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is a single schema change read from migrations/<backend>/NNNN_name.sql
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations returns the embedded migrations of a backend ordered by version
+func loadMigrations(dir string) ([]migration, error) {
+	dir = path.Join("migrations", dir)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_description.sql", entry.Name())
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, entry.Name(), version)
+		}
+		seen[version] = entry.Name()
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// pendingMigrations returns the migrations that have not been applied to the database yet
+func (s *sqlStore) pendingMigrations() ([]migration, error) {
+	migrations, err := loadMigrations(s.dialect.migrations())
+	if err != nil {
+		return nil, err
+	}
+	exists, err := s.dialect.tableExists(s.db, "schema_migrations")
+	if err != nil || !exists {
+		return migrations, err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := s.query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations, each in its own transaction, after
+// backing up the database if the backend supports it. With dryRun the
+// pending migrations are applied in a single transaction that is rolled
+// back, checking that the upgrade would succeed while leaving the database
+// untouched.
+func (s *sqlStore) Migrate(dryRun bool) error {
+	pending, err := s.pendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		log.Printf("Database schema is up to date")
+		return nil
+	}
+
+	if dryRun {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, m := range pending {
+			if err := s.applyMigration(tx, m); err != nil {
+				return fmt.Errorf("migration %s: %w", m.Name, err)
+			}
+			log.Printf("Migration %s would be applied", m.Name)
+		}
+		return nil
+	}
+
+	backup, err := s.dialect.backup(s.db)
+	if err != nil {
+		return fmt.Errorf("backing up database before migration: %w", err)
+	}
+	if backup != "" {
+		log.Printf("Backed up database to %s", backup)
+	}
+
+	for _, m := range pending {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := s.applyMigration(tx, m); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		log.Printf("Applied migration %s", m.Name)
+	}
+	return nil
+}
+
+// applyMigration runs a migration and records it in schema_migrations
+func (s *sqlStore) applyMigration(tx *sql.Tx, m migration) error {
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.dialect.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+		m.Version, m.Name, time.Now().UTC().Format(timestampLayout))
+	return err
+}
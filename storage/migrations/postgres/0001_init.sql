@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS debts (
+	id BIGSERIAL PRIMARY KEY,
+	from_user TEXT NOT NULL,
+	to_user TEXT NOT NULL,
+	amount BIGINT NOT NULL,
+	reason TEXT,
+	chat_id BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	operation_type TEXT NOT NULL DEFAULT 'debt',
+	operation_id INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE SEQUENCE IF NOT EXISTS operation_id_seq;
+
+CREATE TABLE IF NOT EXISTS tags (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS operation_tags (
+	chat_id BIGINT NOT NULL,
+	operation_id INTEGER NOT NULL,
+	tag_id BIGINT NOT NULL REFERENCES tags(id),
+	PRIMARY KEY (chat_id, operation_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS operation_categories (
+	chat_id BIGINT NOT NULL,
+	operation_id INTEGER NOT NULL,
+	category TEXT NOT NULL,
+	PRIMARY KEY (chat_id, operation_id)
+);
+
+CREATE TABLE IF NOT EXISTS chat_settings (
+	chat_id BIGINT PRIMARY KEY,
+	timezone TEXT
+);
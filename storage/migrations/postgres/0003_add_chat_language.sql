@@ -0,0 +1 @@
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS language TEXT;
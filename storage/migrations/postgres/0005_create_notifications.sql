@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id BIGINT PRIMARY KEY,
+	mode TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS queued_notifications (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	text TEXT NOT NULL
+);
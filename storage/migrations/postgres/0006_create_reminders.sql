@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS reminders (
+	chat_id BIGINT PRIMARY KEY,
+	frequency TEXT NOT NULL,
+	min_age_days INTEGER NOT NULL,
+	direct BOOLEAN NOT NULL DEFAULT FALSE,
+	next_run TIMESTAMPTZ NOT NULL
+);
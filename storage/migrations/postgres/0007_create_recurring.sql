@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recurring (
+	id BIGSERIAL PRIMARY KEY,
+	chat_id BIGINT NOT NULL,
+	author TEXT NOT NULL,
+	frequency TEXT NOT NULL,
+	day INTEGER NOT NULL DEFAULT 0,
+	text TEXT NOT NULL,
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	next_run TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE debts ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
@@ -0,0 +1,9 @@
+-- Operations made of returns only and saved without a reason pay back
+-- earlier debts. Statistics tell them from shared expenses by category.
+INSERT INTO operation_categories (chat_id, operation_id, category)
+SELECT chat_id, operation_id, 'возврат долга'
+FROM debts
+WHERE operation_id IS NOT NULL
+GROUP BY chat_id, operation_id
+HAVING MIN(operation_type) = 'return' AND MAX(operation_type) = 'return' AND MAX(COALESCE(reason, '')) = ''
+ON CONFLICT (chat_id, operation_id) DO UPDATE SET category = excluded.category;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS debts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	from_user TEXT NOT NULL,
+	to_user TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	reason TEXT,
+	chat_id INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	operation_type TEXT DEFAULT 'debt',
+	operation_id INTEGER DEFAULT 1
+);
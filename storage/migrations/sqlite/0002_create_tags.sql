@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS operation_tags (
+	chat_id INTEGER NOT NULL,
+	operation_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL REFERENCES tags(id),
+	PRIMARY KEY (chat_id, operation_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS operation_categories (
+	chat_id INTEGER NOT NULL,
+	operation_id INTEGER NOT NULL,
+	category TEXT NOT NULL,
+	PRIMARY KEY (chat_id, operation_id)
+);
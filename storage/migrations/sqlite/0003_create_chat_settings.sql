@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS chat_settings (
+	chat_id INTEGER PRIMARY KEY,
+	timezone TEXT
+);
+
+CREATE TABLE IF NOT EXISTS meta (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
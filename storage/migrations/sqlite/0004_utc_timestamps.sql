@@ -0,0 +1,9 @@
+-- Rows written before timestamps were normalized hold the server's wall
+-- clock time. The 'utc' modifier converts them from the local zone to UTC.
+-- Databases that already went through this conversion carry a marker in meta.
+UPDATE debts
+SET created_at = datetime(created_at, 'utc')
+WHERE NOT EXISTS (SELECT 1 FROM meta WHERE key = 'timestamps_utc')
+	AND datetime(created_at) IS NOT NULL;
+
+INSERT OR IGNORE INTO meta (key, value) VALUES ('timestamps_utc', '1');
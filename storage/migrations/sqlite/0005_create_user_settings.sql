@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+	username TEXT PRIMARY KEY,
+	gender TEXT
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS chats (
+	chat_id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	username TEXT NOT NULL DEFAULT '',
+	last_message_id INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_names (
+	user_id INTEGER NOT NULL,
+	username TEXT NOT NULL,
+	PRIMARY KEY (user_id, username)
+);
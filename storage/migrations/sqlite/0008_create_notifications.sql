@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notification_settings (
+	user_id INTEGER PRIMARY KEY,
+	mode TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS queued_notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	text TEXT NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS reminders (
+	chat_id INTEGER PRIMARY KEY,
+	frequency TEXT NOT NULL,
+	min_age_days INTEGER NOT NULL,
+	direct INTEGER NOT NULL DEFAULT 0,
+	next_run TIMESTAMP NOT NULL
+);
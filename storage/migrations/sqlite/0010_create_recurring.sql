@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recurring (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	author TEXT NOT NULL,
+	frequency TEXT NOT NULL,
+	day INTEGER NOT NULL DEFAULT 0,
+	text TEXT NOT NULL,
+	paused INTEGER NOT NULL DEFAULT 0,
+	next_run TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE debts ADD COLUMN due_at TIMESTAMP;
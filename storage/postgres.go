@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresDialect stores timestamps as TIMESTAMPTZ and operation IDs in a sequence
+type postgresDialect struct{}
+
+func openPostgres(url string) (Store, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlStore{db: db, dialect: postgresDialect{}}, nil
+}
+
+func (postgresDialect) rebind(query string) string {
+	return rebindNumbered(query)
+}
+
+func (postgresDialect) timeArg(t time.Time) interface{} {
+	return t.UTC()
+}
+
+func (postgresDialect) nextOperationID(tx *sql.Tx) (int, error) {
+	var id int
+	err := tx.QueryRow(`SELECT nextval('operation_id_seq')`).Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) migrations() string {
+	return "postgres"
+}
+
+func (postgresDialect) tableExists(db *sql.DB, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	return exists, err
+}
+
+func (postgresDialect) backup(db *sql.DB) (string, error) {
+	log.Printf("Skipping backup of PostgreSQL database, take one with pg_dump if needed")
+	return "", nil
+}
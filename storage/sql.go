@@ -0,0 +1,793 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect holds what differs between the SQL backends
+type dialect interface {
+	// rebind rewrites ? placeholders into the backend's syntax
+	rebind(query string) string
+	// timeArg converts a time into a query argument comparable with created_at
+	timeArg(t time.Time) interface{}
+	// nextOperationID reserves a new operation ID inside tx
+	nextOperationID(tx *sql.Tx) (int, error)
+	// migrations returns the name of the migrations directory of the backend
+	migrations() string
+	// tableExists reports whether a table exists
+	tableExists(db *sql.DB, name string) (bool, error)
+	// backup copies the database before migrations and returns where to
+	backup(db *sql.DB) (string, error)
+}
+
+// sqlStore implements Store on top of database/sql
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) SaveOperation(op Operation) (int, error) {
+	ids, err := s.SaveOperations([]Operation{op})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+func (s *sqlStore) SaveOperations(ops []Operation) ([]int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int
+	for _, op := range ops {
+		id, err := s.saveOperation(tx, op)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, tx.Commit()
+}
+
+// saveOperation records an operation inside tx and returns its new ID
+func (s *sqlStore) saveOperation(tx *sql.Tx, op Operation) (int, error) {
+	operationID, err := s.dialect.nextOperationID(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	insert := s.dialect.rebind(`
+		INSERT INTO debts (from_user, to_user, amount, reason, chat_id, created_at, operation_type, operation_id, due_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	for _, entry := range op.Entries {
+		entryType := entry.Type
+		if entryType == "" {
+			entryType = TypeDebt
+		}
+		var due interface{}
+		if !entry.Due.IsZero() {
+			due = s.dialect.timeArg(entry.Due)
+		}
+		_, err := tx.Exec(insert, entry.From, entry.To, entry.Amount, entry.Reason, op.ChatID,
+			s.dialect.timeArg(entry.Time), entryType, operationID, due)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, tag := range op.Tags {
+		if _, err := tx.Exec(s.dialect.rebind(`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`), tag); err != nil {
+			return 0, err
+		}
+		_, err := tx.Exec(s.dialect.rebind(`
+			INSERT INTO operation_tags (chat_id, operation_id, tag_id)
+			SELECT CAST(? AS BIGINT), CAST(? AS INTEGER), id FROM tags WHERE name = ?
+			ON CONFLICT DO NOTHING
+		`), op.ChatID, operationID, tag)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if op.Category != "" {
+		_, err = tx.Exec(s.dialect.rebind(`
+			INSERT INTO operation_categories (chat_id, operation_id, category) VALUES (?, ?, ?)
+			ON CONFLICT (chat_id, operation_id) DO UPDATE SET category = excluded.category
+		`), op.ChatID, operationID, op.Category)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return operationID, nil
+}
+
+func (s *sqlStore) NetBalance(chatID int64, a, b string) (int, error) {
+	var net int
+	err := s.queryRow(`
+		SELECT COALESCE(SUM(CASE WHEN from_user = ? THEN amount ELSE -amount END), 0)
+		FROM debts
+		WHERE chat_id = ? AND ((from_user = ? AND to_user = ?) OR (from_user = ? AND to_user = ?))
+	`, a, chatID, a, b, b, a).Scan(&net)
+	return net, err
+}
+
+// entryColumns are the columns scanned by scanEntries, in order
+const entryColumns = `operation_id, chat_id, from_user, to_user, amount, COALESCE(reason, ''), operation_type, created_at, due_at`
+
+func scanEntries(rows *sql.Rows) ([]Entry, error) {
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var createdAt, due timestamp
+		err := rows.Scan(&entry.OperationID, &entry.ChatID, &entry.From, &entry.To, &entry.Amount,
+			&entry.Reason, &entry.Type, &createdAt, &due)
+		if err != nil {
+			return nil, err
+		}
+		entry.Time = createdAt.Time
+		entry.Due = due.Time
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) Entries(chatID int64, since time.Time) ([]Entry, error) {
+	query := `SELECT ` + entryColumns + ` FROM debts WHERE chat_id = ?`
+	args := []interface{}{chatID}
+	if !since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, s.dialect.timeArg(since))
+	}
+	rows, err := s.query(query+` ORDER BY created_at, operation_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func (s *sqlStore) History(chatID int64, filter HistoryFilter, offset, limit int) ([]Entry, int, error) {
+	conditions := []string{"chat_id = ?"}
+	args := []interface{}{chatID}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, s.dialect.timeArg(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, s.dialect.timeArg(filter.Until))
+	}
+	if filter.User != "" {
+		conditions = append(conditions, "(from_user = ? OR to_user = ?)")
+		args = append(args, filter.User, filter.User)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, `operation_id IN (
+			SELECT ot.operation_id FROM operation_tags ot JOIN tags t ON t.id = ot.tag_id
+			WHERE ot.chat_id = ? AND t.name = ?
+		)`)
+		args = append(args, chatID, filter.Tag)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "operation_type = ?")
+		args = append(args, filter.Type)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := s.queryRow(`SELECT COUNT(*) FROM debts WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.query(`
+		SELECT `+entryColumns+`
+		FROM debts
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := scanEntries(rows)
+	return entries, total, err
+}
+
+func (s *sqlStore) LastOperation(chatID int64) (Operation, error) {
+	op := Operation{ChatID: chatID}
+	err := s.queryRow(`
+		SELECT operation_id, from_user
+		FROM debts
+		WHERE chat_id = ?
+		ORDER BY operation_id DESC, created_at DESC
+		LIMIT 1
+	`, chatID).Scan(&op.ID, &op.Author)
+	if err == sql.ErrNoRows {
+		return op, ErrNotFound
+	}
+	if err != nil {
+		return op, err
+	}
+
+	rows, err := s.query(`SELECT `+entryColumns+` FROM debts WHERE chat_id = ? AND operation_id = ? ORDER BY created_at, id`, chatID, op.ID)
+	if err != nil {
+		return op, err
+	}
+	op.Entries, err = scanEntries(rows)
+	return op, err
+}
+
+func (s *sqlStore) CancelOperation(chatID int64, operationID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(s.dialect.rebind(`DELETE FROM debts WHERE chat_id = ? AND operation_id = ?`), chatID, operationID)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM operation_tags WHERE chat_id = ? AND operation_id = ?`), chatID, operationID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM operation_categories WHERE chat_id = ? AND operation_id = ?`), chatID, operationID); err != nil {
+		return 0, err
+	}
+	return int(deleted), tx.Commit()
+}
+
+func (s *sqlStore) Members(chatID int64) ([]string, error) {
+	rows, err := s.query(`
+		SELECT from_user FROM debts WHERE chat_id = ?
+		UNION
+		SELECT to_user FROM debts WHERE chat_id = ?
+		ORDER BY 1
+	`, chatID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// DefaultCategory is reported for operations that were saved without a category
+const DefaultCategory = "прочее"
+
+// RepaymentCategory marks operations that only pay back earlier debts. They
+// move money between members without anything being bought, so statistics
+// leave them out. Hashtags cannot contain spaces, so no tag turns into it.
+const RepaymentCategory = "возврат долга"
+
+// notRepayment leaves out the rows of repayment operations. Its arguments
+// are the chat ID and RepaymentCategory.
+const notRepayment = `operation_id NOT IN (SELECT operation_id FROM operation_categories WHERE chat_id = ? AND category = ?)`
+
+func (s *sqlStore) CategoryTotals(chatID int64, since time.Time) ([]CategoryTotal, error) {
+	rows, err := s.query(`
+		SELECT COALESCE(c.category, ?), SUM(d.amount), COUNT(DISTINCT d.operation_id)
+		FROM debts d
+		LEFT JOIN operation_categories c ON c.chat_id = d.chat_id AND c.operation_id = d.operation_id
+		WHERE d.chat_id = ? AND d.created_at >= ? AND COALESCE(c.category, '') <> ?
+		GROUP BY 1
+		ORDER BY 2 DESC
+	`, DefaultCategory, chatID, s.dialect.timeArg(since), RepaymentCategory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []CategoryTotal
+	for rows.Next() {
+		var total CategoryTotal
+		if err := rows.Scan(&total.Category, &total.Amount, &total.Operations); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+func (s *sqlStore) MemberStats(chatID int64, since time.Time) ([]MemberStats, error) {
+	rows, err := s.query(`
+		SELECT member, SUM(paid), SUM(consumed)
+		FROM (
+			SELECT from_user AS member, amount AS paid, 0 AS consumed, chat_id, created_at, operation_id FROM debts
+			UNION ALL
+			SELECT to_user AS member, 0 AS paid, amount AS consumed, chat_id, created_at, operation_id FROM debts
+		) AS totals
+		WHERE chat_id = ? AND created_at >= ? AND `+notRepayment+`
+		GROUP BY member
+		ORDER BY SUM(paid) - SUM(consumed) DESC, member
+	`, chatID, s.dialect.timeArg(since), chatID, RepaymentCategory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []MemberStats
+	for rows.Next() {
+		var stat MemberStats
+		if err := rows.Scan(&stat.User, &stat.Paid, &stat.Consumed); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+func (s *sqlStore) LargestExpenses(chatID int64, since time.Time, limit int) ([]Expense, error) {
+	rows, err := s.query(`
+		SELECT operation_id, from_user, SUM(amount), COALESCE(MAX(reason), ''), MIN(created_at)
+		FROM debts
+		WHERE chat_id = ? AND created_at >= ? AND `+notRepayment+`
+		GROUP BY operation_id, from_user
+		ORDER BY SUM(amount) DESC, operation_id DESC
+		LIMIT ?
+	`, chatID, s.dialect.timeArg(since), chatID, RepaymentCategory, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []Expense
+	for rows.Next() {
+		var expense Expense
+		var createdAt timestamp
+		if err := rows.Scan(&expense.OperationID, &expense.From, &expense.Amount, &expense.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		expense.Time = createdAt.Time
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
+func (s *sqlStore) BusiestDays(chatID int64, since time.Time, loc *time.Location, limit int) ([]DayStats, error) {
+	// Days are told apart in Go, where the offset of loc is right for every
+	// row even across daylight saving transitions
+	rows, err := s.query(`
+		SELECT operation_id, amount, created_at
+		FROM debts
+		WHERE chat_id = ? AND created_at >= ? AND `+notRepayment+`
+	`, chatID, s.dialect.timeArg(since), chatID, RepaymentCategory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var createdAt timestamp
+		if err := rows.Scan(&entry.OperationID, &entry.Amount, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.Time = createdAt.Time
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return busiestDays(entries, loc, limit), nil
+}
+
+func (s *sqlStore) ChatTimezone(chatID int64) (string, error) {
+	var name sql.NullString
+	err := s.queryRow(`SELECT timezone FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name.String, err
+}
+
+func (s *sqlStore) SetChatTimezone(chatID int64, name string) error {
+	_, err := s.exec(`
+		INSERT INTO chat_settings (chat_id, timezone) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET timezone = excluded.timezone
+	`, chatID, name)
+	return err
+}
+
+func (s *sqlStore) ChatLanguage(chatID int64) (string, error) {
+	var code sql.NullString
+	err := s.queryRow(`SELECT language FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return code.String, err
+}
+
+func (s *sqlStore) SetChatLanguage(chatID int64, code string) error {
+	_, err := s.exec(`
+		INSERT INTO chat_settings (chat_id, language) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET language = excluded.language
+	`, chatID, code)
+	return err
+}
+
+func (s *sqlStore) SaveChat(chat Chat) error {
+	_, err := s.exec(`
+		INSERT INTO chats (chat_id, title, username, last_message_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET title = excluded.title, username = excluded.username,
+			last_message_id = excluded.last_message_id
+	`, chat.ID, chat.Title, chat.Username, chat.LastMessageID)
+	return err
+}
+
+func (s *sqlStore) Chat(chatID int64) (Chat, error) {
+	chat := Chat{ID: chatID}
+	err := s.queryRow(`SELECT title, username, last_message_id FROM chats WHERE chat_id = ?`, chatID).
+		Scan(&chat.Title, &chat.Username, &chat.LastMessageID)
+	if err == sql.ErrNoRows {
+		return Chat{}, ErrNotFound
+	}
+	return chat, err
+}
+
+func (s *sqlStore) UserChats(usernames []string) ([]Chat, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(usernames)), ", ")
+	var args []interface{}
+	for i := 0; i < 2; i++ {
+		for _, username := range usernames {
+			args = append(args, username)
+		}
+	}
+	rows, err := s.query(`
+		SELECT chat_id, title, username, last_message_id FROM chats
+		WHERE chat_id IN (
+			SELECT chat_id FROM debts
+			WHERE from_user IN (`+placeholders+`) OR to_user IN (`+placeholders+`)
+		)
+		ORDER BY title, chat_id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []Chat
+	for rows.Next() {
+		var chat Chat
+		if err := rows.Scan(&chat.ID, &chat.Title, &chat.Username, &chat.LastMessageID); err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+func (s *sqlStore) SaveUsername(userID int64, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM user_names WHERE username = ? AND user_id <> ?`), username, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(s.dialect.rebind(`
+		INSERT INTO user_names (user_id, username) VALUES (?, ?)
+		ON CONFLICT (user_id, username) DO NOTHING
+	`), userID, username)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Usernames(userID int64) ([]string, error) {
+	rows, err := s.query(`SELECT username FROM user_names WHERE user_id = ? ORDER BY username`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+func (s *sqlStore) UserID(username string) (int64, error) {
+	var userID int64
+	err := s.queryRow(`SELECT user_id FROM user_names WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
+
+func (s *sqlStore) NotifyMode(userID int64) (NotifyMode, error) {
+	var mode string
+	err := s.queryRow(`SELECT mode FROM notification_settings WHERE user_id = ?`, userID).Scan(&mode)
+	if err == sql.ErrNoRows {
+		return NotifyUnset, nil
+	}
+	return NotifyMode(mode), err
+}
+
+func (s *sqlStore) SetNotifyMode(userID int64, mode NotifyMode) error {
+	_, err := s.exec(`
+		INSERT INTO notification_settings (user_id, mode) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET mode = excluded.mode
+	`, userID, string(mode))
+	return err
+}
+
+func (s *sqlStore) QueueNotification(userID int64, text string) error {
+	_, err := s.exec(`INSERT INTO queued_notifications (user_id, text) VALUES (?, ?)`, userID, text)
+	return err
+}
+
+func (s *sqlStore) TakeNotifications() (map[int64][]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, user_id, text FROM queued_notifications ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make(map[int64][]string)
+	lastID := int64(0)
+	for rows.Next() {
+		var userID int64
+		var text string
+		if err := rows.Scan(&lastID, &userID, &text); err != nil {
+			return nil, err
+		}
+		notifications[userID] = append(notifications[userID], text)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Notifications queued while reading wait for the next digest
+	if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM queued_notifications WHERE id <= ?`), lastID); err != nil {
+		return nil, err
+	}
+	return notifications, tx.Commit()
+}
+
+func (s *sqlStore) DropNotifications(userID int64) error {
+	_, err := s.exec(`DELETE FROM queued_notifications WHERE user_id = ?`, userID)
+	return err
+}
+
+func (s *sqlStore) Reminder(chatID int64) (Reminder, error) {
+	reminders, err := s.reminders(`WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return Reminder{}, err
+	}
+	if len(reminders) == 0 {
+		return Reminder{}, ErrNotFound
+	}
+	return reminders[0], nil
+}
+
+func (s *sqlStore) SaveReminder(reminder Reminder) error {
+	_, err := s.exec(`
+		INSERT INTO reminders (chat_id, frequency, min_age_days, direct, next_run) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			frequency = excluded.frequency, min_age_days = excluded.min_age_days,
+			direct = excluded.direct, next_run = excluded.next_run
+	`, reminder.ChatID, string(reminder.Frequency), reminder.MinAge, reminder.Direct, s.dialect.timeArg(reminder.NextRun))
+	return err
+}
+
+func (s *sqlStore) DeleteReminder(chatID int64) error {
+	_, err := s.exec(`DELETE FROM reminders WHERE chat_id = ?`, chatID)
+	return err
+}
+
+func (s *sqlStore) DueReminders(now time.Time) ([]Reminder, error) {
+	return s.reminders(`WHERE next_run <= ? ORDER BY next_run, chat_id`, s.dialect.timeArg(now))
+}
+
+// reminders returns the reminders matching a WHERE clause
+func (s *sqlStore) reminders(where string, args ...interface{}) ([]Reminder, error) {
+	rows, err := s.query(`SELECT chat_id, frequency, min_age_days, direct, next_run FROM reminders `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		var reminder Reminder
+		var frequency string
+		var nextRun timestamp
+		if err := rows.Scan(&reminder.ChatID, &frequency, &reminder.MinAge, &reminder.Direct, &nextRun); err != nil {
+			return nil, err
+		}
+		reminder.Frequency = Frequency(frequency)
+		reminder.NextRun = nextRun.Time
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+func (s *sqlStore) AddRecurring(recurring Recurring) (int, error) {
+	var id int
+	err := s.queryRow(`
+		INSERT INTO recurring (chat_id, author, frequency, day, text, paused, next_run) VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, recurring.ChatID, recurring.Author, string(recurring.Frequency), recurring.Day, recurring.Text,
+		recurring.Paused, s.dialect.timeArg(recurring.NextRun)).Scan(&id)
+	return id, err
+}
+
+func (s *sqlStore) Recurrings(chatID int64) ([]Recurring, error) {
+	return s.recurrings(`WHERE chat_id = ? ORDER BY id`, chatID)
+}
+
+func (s *sqlStore) UpdateRecurring(recurring Recurring) (bool, error) {
+	result, err := s.exec(`UPDATE recurring SET paused = ?, next_run = ? WHERE chat_id = ? AND id = ?`,
+		recurring.Paused, s.dialect.timeArg(recurring.NextRun), recurring.ChatID, recurring.ID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (s *sqlStore) DeleteRecurring(chatID int64, id int) (bool, error) {
+	result, err := s.exec(`DELETE FROM recurring WHERE chat_id = ? AND id = ?`, chatID, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (s *sqlStore) DueRecurrings(now time.Time) ([]Recurring, error) {
+	return s.recurrings(`WHERE NOT paused AND next_run <= ? ORDER BY next_run, id`, s.dialect.timeArg(now))
+}
+
+// recurrings returns the recurring operations matching a WHERE clause
+func (s *sqlStore) recurrings(where string, args ...interface{}) ([]Recurring, error) {
+	rows, err := s.query(`SELECT id, chat_id, author, frequency, day, text, paused, next_run FROM recurring `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recurrings []Recurring
+	for rows.Next() {
+		var recurring Recurring
+		var frequency string
+		var nextRun timestamp
+		err := rows.Scan(&recurring.ID, &recurring.ChatID, &recurring.Author, &frequency, &recurring.Day,
+			&recurring.Text, &recurring.Paused, &nextRun)
+		if err != nil {
+			return nil, err
+		}
+		recurring.Frequency = Frequency(frequency)
+		recurring.NextRun = nextRun.Time
+		recurrings = append(recurrings, recurring)
+	}
+	return recurrings, rows.Err()
+}
+
+func (s *sqlStore) UserGender(username string) (Gender, error) {
+	var gender sql.NullString
+	err := s.queryRow(`SELECT gender FROM user_settings WHERE username = ?`, username).Scan(&gender)
+	if err == sql.ErrNoRows {
+		return GenderUnset, nil
+	}
+	return Gender(gender.String), err
+}
+
+func (s *sqlStore) SetUserGender(username string, gender Gender) error {
+	_, err := s.exec(`
+		INSERT INTO user_settings (username, gender) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET gender = excluded.gender
+	`, username, string(gender))
+	return err
+}
+
+// timestampLayout is how SQLite stores timestamps. They are always UTC, so
+// they compare correctly as strings and with SQLite's own datetime('now').
+const timestampLayout = "2006-01-02 15:04:05"
+
+// timestamp scans created_at whichever way the driver returns it: the sqlite
+// driver hands TIMESTAMP columns back as time.Time but aggregates such as
+// MIN(created_at) as stored text, while PostgreSQL always returns time.Time.
+// NULL, such as a missing due_at, scans as the zero time.
+type timestamp struct {
+	time.Time
+}
+
+func (t *timestamp) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	case time.Time:
+		t.Time = v.UTC()
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	default:
+		return fmt.Errorf("storage: cannot scan %T into timestamp", value)
+	}
+}
+
+func (t *timestamp) parse(value string) error {
+	parsed, err := time.Parse(timestampLayout, value)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339Nano, value)
+	}
+	t.Time = parsed.UTC()
+	return err
+}
+
+// rebindNumbered rewrites ? placeholders into $1, $2, ...
+func rebindNumbered(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
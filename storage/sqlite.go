@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDialect stores timestamps as UTC text in timestampLayout
+type sqliteDialect struct {
+	path string
+}
+
+func openSQLite(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; sharing one connection between the
+	// workers queues them up instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+	return &sqlStore{db: db, dialect: sqliteDialect{path: path}}, nil
+}
+
+func (sqliteDialect) rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) timeArg(t time.Time) interface{} {
+	return t.UTC().Format(timestampLayout)
+}
+
+func (sqliteDialect) nextOperationID(tx *sql.Tx) (int, error) {
+	// SQLite serializes writers, so the maximum cannot change under the transaction
+	var maxID int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(operation_id), 0) FROM debts`).Scan(&maxID)
+	return maxID + 1, err
+}
+
+func (sqliteDialect) migrations() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) tableExists(db *sql.DB, name string) (bool, error) {
+	var tables int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&tables)
+	return tables > 0, err
+}
+
+// backup copies the database file next to itself. Databases without any
+// tables besides schema_migrations are not backed up.
+func (d sqliteDialect) backup(db *sql.DB) (string, error) {
+	var tables int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')
+	`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return "", err
+	}
+
+	backup := fmt.Sprintf("%s.backup-%s", d.path, time.Now().UTC().Format("20060102-150405"))
+	if _, err := os.Stat(backup); err == nil {
+		return "", fmt.Errorf("backup %s already exists", backup)
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
@@ -0,0 +1,321 @@
+// Package storage keeps the ledger of every chat. Store is implemented by
+// SQL backends for SQLite and PostgreSQL and by an in-memory store, selected
+// by a database URL.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operation types of an entry
+const (
+	TypeDebt   = "debt"
+	TypeReturn = "return"
+)
+
+// ErrNotFound is returned when there is no operation, chat or reminder to look up
+var ErrNotFound = errors.New("storage: not found")
+
+// Entry is a single row of a ledger: To owes From Amount kopecks, or From
+// returned Amount kopecks to To when Type is TypeReturn.
+type Entry struct {
+	OperationID int
+	ChatID      int64
+	From        string
+	To          string
+	Amount      int
+	Reason      string
+	Type        string
+	Time        time.Time
+	Due         time.Time // date a debt is promised to be returned by, midnight UTC; zero if none
+}
+
+// Operation is a group of entries recorded by one message
+type Operation struct {
+	ID       int
+	ChatID   int64
+	Author   string
+	Entries  []Entry
+	Tags     []string
+	Category string
+}
+
+// HistoryFilter narrows down the entries returned by History. Zero fields
+// are not applied.
+type HistoryFilter struct {
+	Since time.Time
+	Until time.Time
+	User  string
+	Tag   string
+	Type  string
+}
+
+// CategoryTotal is the amount spent in a chat on a single category
+type CategoryTotal struct {
+	Category   string
+	Amount     int
+	Operations int
+}
+
+// MemberStats is the spending summary of a single chat member
+type MemberStats struct {
+	User     string
+	Paid     int
+	Consumed int
+}
+
+// Net returns how much the member paid for others beyond what they consumed
+func (s MemberStats) Net() int {
+	return s.Paid - s.Consumed
+}
+
+// Expense is a single operation summed over all of its entries
+type Expense struct {
+	OperationID int
+	From        string
+	Amount      int
+	Reason      string
+	Time        time.Time
+}
+
+// DayStats is the activity of a chat on a single calendar day
+type DayStats struct {
+	Day        string
+	Operations int
+	Amount     int
+}
+
+// busiestDays groups entries by their calendar day in loc and returns up to
+// limit days with the most operations, then the biggest amount
+func busiestDays(entries []Entry, loc *time.Location, limit int) []DayStats {
+	byDay := make(map[string]*DayStats)
+	operations := make(map[string]map[int]bool)
+	var days []*DayStats
+	for _, entry := range entries {
+		day := entry.Time.In(loc).Format("2006-01-02")
+		stat := byDay[day]
+		if stat == nil {
+			stat = &DayStats{Day: day}
+			byDay[day] = stat
+			operations[day] = make(map[int]bool)
+			days = append(days, stat)
+		}
+		stat.Amount += entry.Amount
+		operations[day][entry.OperationID] = true
+		stat.Operations = len(operations[day])
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		if days[i].Operations != days[j].Operations {
+			return days[i].Operations > days[j].Operations
+		}
+		if days[i].Amount != days[j].Amount {
+			return days[i].Amount > days[j].Amount
+		}
+		return days[i].Day < days[j].Day
+	})
+
+	var result []DayStats
+	for _, day := range days {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, *day)
+	}
+	return result
+}
+
+// Chat is a group chat the bot has seen a message in
+type Chat struct {
+	ID            int64
+	Title         string
+	Username      string // public username of the chat, empty if it has none
+	LastMessageID int    // latest message seen, for links into the chat
+}
+
+// Gender is the grammatical gender a user is addressed in
+type Gender string
+
+const (
+	GenderUnset   Gender = ""
+	GenderMale    Gender = "m"
+	GenderFemale  Gender = "f"
+	GenderNeutral Gender = "n"
+)
+
+// NotifyMode is how a user hears about operations involving them in direct messages
+type NotifyMode string
+
+const (
+	NotifyUnset NotifyMode = ""
+	NotifyNow   NotifyMode = "now"   // as soon as they are recorded
+	NotifyDaily NotifyMode = "daily" // in a daily digest
+	NotifyMute  NotifyMode = "mute"  // not at all
+)
+
+// Frequency is how often a scheduled job runs
+type Frequency string
+
+const (
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+)
+
+// Reminder is the schedule of a chat's summary of old debts
+type Reminder struct {
+	ChatID    int64
+	Frequency Frequency
+	MinAge    int       // only debts older than this many days are listed
+	Direct    bool      // sent privately to every debtor instead of to the chat
+	NextRun   time.Time // when the summary is due
+}
+
+// Recurring is a debt message recorded on behalf of its author on a schedule
+type Recurring struct {
+	ID        int
+	ChatID    int64
+	Author    string
+	Frequency Frequency
+	Day       int    // day of the week (1 is Monday) or of the month it runs on, 0 for daily
+	Text      string // the debt message, e.g. "@all 45000 аренда"
+	Paused    bool
+	NextRun   time.Time // when the message is recorded next
+}
+
+// Store is the ledger storage shared by all chats
+type Store interface {
+	// SaveOperation records the entries, tags and category of an operation
+	// atomically under a new operation ID and returns that ID.
+	SaveOperation(op Operation) (int, error)
+	// SaveOperations records several operations in a single transaction,
+	// all or none of them, and returns their IDs in order
+	SaveOperations(ops []Operation) ([]int, error)
+	// NetBalance returns how much b owes a in a chat, negative if a owes b
+	NetBalance(chatID int64, a, b string) (int, error)
+	// Entries returns the entries of a chat from since on, oldest first.
+	// A zero since returns every entry.
+	Entries(chatID int64, since time.Time) ([]Entry, error)
+	// History returns a page of the entries matching the filter, newest
+	// first, together with the total number of matching entries.
+	History(chatID int64, filter HistoryFilter, offset, limit int) ([]Entry, int, error)
+	// LastOperation returns the latest operation of a chat with its entries,
+	// or ErrNotFound.
+	LastOperation(chatID int64) (Operation, error)
+	// CancelOperation deletes an operation with its tags and returns the
+	// number of deleted entries.
+	CancelOperation(chatID int64, operationID int) (int, error)
+	// Members returns every username that appears in a chat's ledger
+	Members(chatID int64) ([]string, error)
+
+	// CategoryTotals sums the entries of a chat from since on by category.
+	// Repayments are not spending and are left out.
+	CategoryTotals(chatID int64, since time.Time) ([]CategoryTotal, error)
+	// MemberStats returns per-member totals from since on, biggest net first
+	MemberStats(chatID int64, since time.Time) ([]MemberStats, error)
+	// LargestExpenses returns up to limit operations with the biggest total from since on
+	LargestExpenses(chatID int64, since time.Time, limit int) ([]Expense, error)
+	// BusiestDays returns up to limit calendar days in loc with the most
+	// operations from since on
+	BusiestDays(chatID int64, since time.Time, loc *time.Location, limit int) ([]DayStats, error)
+
+	// ChatTimezone returns the time zone name of a chat, or "" if unset
+	ChatTimezone(chatID int64) (string, error)
+	// SetChatTimezone stores the time zone name of a chat
+	SetChatTimezone(chatID int64, name string) error
+	// ChatLanguage returns the language code of a chat, or "" if unset
+	ChatLanguage(chatID int64) (string, error)
+	// SetChatLanguage stores the language code of a chat
+	SetChatLanguage(chatID int64, code string) error
+
+	// SaveChat stores or updates a chat
+	SaveChat(chat Chat) error
+	// Chat returns a chat the bot has seen, or ErrNotFound
+	Chat(chatID int64) (Chat, error)
+	// UserChats returns the chats whose ledger mentions any of usernames,
+	// ordered by title
+	UserChats(usernames []string) ([]Chat, error)
+	// SaveUsername records that a Telegram user goes by a username. A
+	// username belongs to a single user, the last one seen with it.
+	SaveUsername(userID int64, username string) error
+	// Usernames returns every username a Telegram user has gone by
+	Usernames(userID int64) ([]string, error)
+
+	// UserID returns the Telegram user that goes by a username, or 0
+	UserID(username string) (int64, error)
+
+	// NotifyMode returns how a user wants to be notified, or NotifyUnset
+	NotifyMode(userID int64) (NotifyMode, error)
+	// SetNotifyMode stores how a user wants to be notified
+	SetNotifyMode(userID int64, mode NotifyMode) error
+	// QueueNotification keeps a notification for the next digest of a user
+	QueueNotification(userID int64, text string) error
+	// TakeNotifications removes every queued notification and returns them
+	// by user in the order they were queued
+	TakeNotifications() (map[int64][]string, error)
+	// DropNotifications removes the queued notifications of a user
+	DropNotifications(userID int64) error
+
+	// Reminder returns the reminder of a chat, or ErrNotFound
+	Reminder(chatID int64) (Reminder, error)
+	// SaveReminder stores or replaces the reminder of a chat
+	SaveReminder(reminder Reminder) error
+	// DeleteReminder removes the reminder of a chat, if any
+	DeleteReminder(chatID int64) error
+	// DueReminders returns the reminders due at or before now, earliest first
+	DueReminders(now time.Time) ([]Reminder, error)
+
+	// AddRecurring stores a new recurring operation and returns its ID
+	AddRecurring(recurring Recurring) (int, error)
+	// Recurrings returns the recurring operations of a chat ordered by ID
+	Recurrings(chatID int64) ([]Recurring, error)
+	// UpdateRecurring stores whether a recurring operation of a chat is
+	// paused and when it runs next, reporting whether it exists
+	UpdateRecurring(recurring Recurring) (bool, error)
+	// DeleteRecurring removes a recurring operation of a chat, reporting
+	// whether it existed
+	DeleteRecurring(chatID int64, id int) (bool, error)
+	// DueRecurrings returns the recurring operations that are not paused
+	// and due at or before now, earliest first
+	DueRecurrings(now time.Time) ([]Recurring, error)
+
+	// UserGender returns the gender a user chose, or GenderUnset
+	UserGender(username string) (Gender, error)
+	// SetUserGender stores the gender of a user
+	SetUserGender(username string, gender Gender) error
+
+	// Migrate brings the schema up to date. With dryRun pending changes are
+	// checked and rolled back.
+	Migrate(dryRun bool) error
+	Close() error
+}
+
+// DefaultURL is used when no database URL is configured
+const DefaultURL = "sqlite://./debts.db"
+
+// MemoryURL selects the in-memory store
+const MemoryURL = "memory://"
+
+// Open connects to the store described by url: postgres:// or
+// postgresql:// for PostgreSQL, sqlite://path or a bare file path for SQLite
+// and MemoryURL for a store that lives only as long as the process.
+func Open(url string) (Store, error) {
+	if url == "" {
+		url = DefaultURL
+	}
+	switch {
+	case url == MemoryURL:
+		return OpenMemory(), nil
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return openPostgres(url)
+	case strings.HasPrefix(url, "sqlite://"):
+		return openSQLite(strings.TrimPrefix(url, "sqlite://"))
+	case !strings.Contains(url, "://"):
+		return openSQLite(url)
+	default:
+		return nil, fmt.Errorf("storage: unsupported database URL %q", url)
+	}
+}
@@ -0,0 +1,73 @@
+package storage_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"obshyakBot3/storage"
+	"obshyakBot3/storage/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.OpenMemory()
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.Open(filepath.Join(t.TempDir(), "d.db"))
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		return s
+	})
+}
+
+// TestPostgres runs the suite against the PostgreSQL database at
+// TEST_DATABASE_URL, every test in a schema of its own
+func TestPostgres(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer admin.Close()
+	if err := admin.Ping(); err != nil {
+		t.Fatalf("TEST_DATABASE_URL: %v", err)
+	}
+
+	schemas := 0
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		schemas++
+		schema := fmt.Sprintf("storetest_%d_%d", os.Getpid(), schemas)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("CREATE SCHEMA: %v", err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+				t.Errorf("DROP SCHEMA: %v", err)
+			}
+		})
+
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			t.Fatalf("TEST_DATABASE_URL: %v", err)
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		s, err := storage.Open(u.String())
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,765 @@
+// Package storetest is a conformance suite for storage.Store implementations.
+// Every backend is expected to pass it:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storage.Store {
+//			return storage.OpenMemory()
+//		})
+//	}
+package storetest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"obshyakBot3/storage"
+)
+
+// chatID and otherChatID are the chats the suite records operations in
+const (
+	chatID      int64 = -100
+	otherChatID int64 = -200
+)
+
+// Run runs the suite, opening an empty store for every test
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Store)
+	}{
+		{"SaveOperation", testSaveOperation},
+		{"SaveOperations", testSaveOperations},
+		{"NetBalance", testNetBalance},
+		{"Entries", testEntries},
+		{"History", testHistory},
+		{"LastOperation", testLastOperation},
+		{"CancelOperation", testCancelOperation},
+		{"Members", testMembers},
+		{"CategoryTotals", testCategoryTotals},
+		{"MemberStats", testMemberStats},
+		{"LargestExpenses", testLargestExpenses},
+		{"BusiestDays", testBusiestDays},
+		{"ChatTimezone", testChatTimezone},
+		{"ChatLanguage", testChatLanguage},
+		{"UserGender", testUserGender},
+		{"UserChats", testUserChats},
+		{"Usernames", testUsernames},
+		{"Notifications", testNotifications},
+		{"Reminders", testReminders},
+		{"Recurring", testRecurring},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			if err := s.Migrate(false); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+			test.run(t, s)
+		})
+	}
+}
+
+// base is the time of the first operation of every test, far enough in the
+// past to be clear of "now" and whole seconds like stored timestamps
+var base = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func debt(from, to string, amount int, reason string, at time.Time) storage.Entry {
+	return storage.Entry{From: from, To: to, Amount: amount, Reason: reason, Type: storage.TypeDebt, Time: at}
+}
+
+func payback(from, to string, amount int, at time.Time) storage.Entry {
+	return storage.Entry{From: from, To: to, Amount: amount, Type: storage.TypeReturn, Time: at}
+}
+
+func save(t *testing.T, s storage.Store, chat int64, category string, tags []string, entries ...storage.Entry) int {
+	t.Helper()
+	id, err := s.SaveOperation(storage.Operation{ChatID: chat, Entries: entries, Tags: tags, Category: category})
+	if err != nil {
+		t.Fatalf("SaveOperation: %v", err)
+	}
+	return id
+}
+
+// strip drops the fields of entries that tests do not compare
+func strip(entries []storage.Entry) []storage.Entry {
+	var stripped []storage.Entry
+	for _, entry := range entries {
+		entry.OperationID = 0
+		entry.ChatID = 0
+		stripped = append(stripped, entry)
+	}
+	return stripped
+}
+
+func testSaveOperation(t *testing.T, s storage.Store) {
+	first := save(t, s, chatID, "еда", []string{"пицца"},
+		debt("anna", "ivan", 500, "пицца", base),
+		debt("anna", "olga", 500, "пицца", base))
+	second := save(t, s, otherChatID, "", nil,
+		storage.Entry{From: "ivan", To: "anna", Amount: 100, Time: base.Add(time.Minute)})
+	if first <= 0 || second <= first {
+		t.Errorf("operation IDs %d, %d: want positive and increasing", first, second)
+	}
+
+	entries, err := s.Entries(chatID, time.Time{})
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.OperationID != first || entry.ChatID != chatID {
+			t.Errorf("entry %+v: want operation %d in chat %d", entry, first, chatID)
+		}
+		if !entry.Time.Equal(base) || entry.Time.Location() != time.UTC {
+			t.Errorf("entry time %v: want %v in UTC", entry.Time, base)
+		}
+	}
+
+	entries, err = s.Entries(otherChatID, time.Time{})
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Type != storage.TypeDebt {
+		t.Errorf("entry without a type: got %+v, want a single debt", entries)
+	}
+}
+
+func testNetBalance(t *testing.T, s storage.Store) {
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 1000, "", base))
+	save(t, s, chatID, "", nil, payback("ivan", "anna", 300, base.Add(time.Minute)))
+	save(t, s, chatID, "", nil, debt("anna", "olga", 700, "", base.Add(2*time.Minute)))
+	save(t, s, otherChatID, "", nil, debt("anna", "ivan", 5000, "", base))
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"anna", "ivan", 700},
+		{"ivan", "anna", -700},
+		{"anna", "olga", 700},
+		{"ivan", "olga", 0},
+	}
+	for _, test := range tests {
+		got, err := s.NetBalance(chatID, test.a, test.b)
+		if err != nil {
+			t.Fatalf("NetBalance(%s, %s): %v", test.a, test.b, err)
+		}
+		if got != test.want {
+			t.Errorf("NetBalance(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func testSaveOperations(t *testing.T, s storage.Store) {
+	ids, err := s.SaveOperations([]storage.Operation{
+		{ChatID: chatID, Entries: []storage.Entry{debt("anna", "ivan", 500, "пицца", base)}, Tags: []string{"пицца"}, Category: "кафе"},
+		{ChatID: chatID, Entries: []storage.Entry{debt("ivan", "anna", 100, "", base), payback("ivan", "olga", 50, base)}},
+	})
+	if err != nil {
+		t.Fatalf("SaveOperations: %v", err)
+	}
+	if len(ids) != 2 || ids[0] <= 0 || ids[1] <= ids[0] {
+		t.Fatalf("operation IDs %v: want two, positive and increasing", ids)
+	}
+
+	entries, err := s.Entries(chatID, time.Time{})
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if len(entries) != 3 || entries[0].OperationID != ids[0] || entries[1].OperationID != ids[1] || entries[2].OperationID != ids[1] {
+		t.Errorf("entries %+v: want one of operation %d and two of %d", entries, ids[0], ids[1])
+	}
+	if _, total, err := s.History(chatID, storage.HistoryFilter{Tag: "пицца"}, 0, 10); err != nil || total != 1 {
+		t.Errorf("History by tag = %d, %v; want the first operation", total, err)
+	}
+	if id, err := s.SaveOperation(storage.Operation{ChatID: chatID, Entries: []storage.Entry{debt("olga", "anna", 10, "", base)}}); err != nil || id <= ids[1] {
+		t.Errorf("SaveOperation after SaveOperations = %d, %v; want an ID after %d", id, err, ids[1])
+	}
+}
+
+func testEntries(t *testing.T, s storage.Store) {
+	// Saved out of order to check that entries come back by time
+	taxi := debt("anna", "ivan", 300, "такси", base.Add(2*time.Hour))
+	taxi.Due = time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	save(t, s, chatID, "", nil, taxi)
+	save(t, s, chatID, "", nil, debt("ivan", "anna", 100, "кофе", base))
+	save(t, s, chatID, "", nil, payback("olga", "anna", 200, base.Add(time.Hour)))
+
+	entries, err := s.Entries(chatID, time.Time{})
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	want := []storage.Entry{
+		debt("ivan", "anna", 100, "кофе", base),
+		payback("olga", "anna", 200, base.Add(time.Hour)),
+		taxi,
+	}
+	if got := strip(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	entries, err = s.Entries(chatID, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	if got := strip(entries); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("Entries since an hour later:\ngot  %+v\nwant %+v", got, want[1:])
+	}
+
+	entries, err = s.Entries(otherChatID, time.Time{})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Entries of an empty chat = %v, %v; want none", entries, err)
+	}
+}
+
+func testHistory(t *testing.T, s storage.Store) {
+	save(t, s, chatID, "еда", []string{"пицца"},
+		debt("anna", "ivan", 500, "#пицца", base),
+		debt("anna", "olga", 500, "#пицца", base))
+	save(t, s, chatID, "", nil, payback("ivan", "anna", 200, base.Add(time.Hour)))
+	save(t, s, chatID, "транспорт", []string{"такси"}, debt("olga", "anna", 300, "#такси", base.Add(2*time.Hour)))
+	save(t, s, otherChatID, "еда", []string{"пицца"}, debt("anna", "ivan", 900, "#пицца", base))
+
+	tests := []struct {
+		name   string
+		filter storage.HistoryFilter
+		want   []int // amounts, newest first
+	}{
+		{"all", storage.HistoryFilter{}, []int{300, 200, 500, 500}},
+		{"since", storage.HistoryFilter{Since: base.Add(time.Hour)}, []int{300, 200}},
+		{"until", storage.HistoryFilter{Until: base.Add(time.Hour)}, []int{500, 500}},
+		{"user", storage.HistoryFilter{User: "ivan"}, []int{200, 500}},
+		{"tag", storage.HistoryFilter{Tag: "пицца"}, []int{500, 500}},
+		{"type", storage.HistoryFilter{Type: storage.TypeReturn}, []int{200}},
+		{"combined", storage.HistoryFilter{User: "olga", Since: base.Add(time.Minute)}, []int{300}},
+		{"none", storage.HistoryFilter{Tag: "кино"}, nil},
+	}
+	for _, test := range tests {
+		entries, total, err := s.History(chatID, test.filter, 0, 10)
+		if err != nil {
+			t.Fatalf("History %s: %v", test.name, err)
+		}
+		var got []int
+		for _, entry := range entries {
+			got = append(got, entry.Amount)
+		}
+		if !reflect.DeepEqual(got, test.want) || total != len(test.want) {
+			t.Errorf("History %s = %v (total %d), want %v", test.name, got, total, test.want)
+		}
+	}
+
+	entries, total, err := s.History(chatID, storage.HistoryFilter{}, 1, 2)
+	if err != nil {
+		t.Fatalf("History page: %v", err)
+	}
+	if total != 4 || len(entries) != 2 || entries[0].Amount != 200 || entries[1].Amount != 500 {
+		t.Errorf("History page at offset 1 = %+v (total %d), want 200 and 500 of 4", entries, total)
+	}
+
+	entries, total, err = s.History(chatID, storage.HistoryFilter{}, 10, 2)
+	if err != nil || len(entries) != 0 || total != 4 {
+		t.Errorf("History past the end = %v (total %d), %v; want none of 4", entries, total, err)
+	}
+}
+
+func testLastOperation(t *testing.T, s storage.Store) {
+	if _, err := s.LastOperation(chatID); err != storage.ErrNotFound {
+		t.Fatalf("LastOperation of an empty chat: got %v, want ErrNotFound", err)
+	}
+
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 100, "", base))
+	id := save(t, s, chatID, "еда", []string{"пицца"},
+		debt("olga", "ivan", 500, "пицца", base.Add(time.Hour)),
+		payback("olga", "anna", 200, base.Add(time.Hour)))
+	save(t, s, otherChatID, "", nil, debt("ivan", "anna", 100, "", base.Add(2*time.Hour)))
+
+	op, err := s.LastOperation(chatID)
+	if err != nil {
+		t.Fatalf("LastOperation: %v", err)
+	}
+	if op.ID != id || op.ChatID != chatID || op.Author != "olga" {
+		t.Errorf("LastOperation = operation %d in chat %d by %s, want %d in chat %d by olga", op.ID, op.ChatID, op.Author, id, chatID)
+	}
+	want := []storage.Entry{
+		debt("olga", "ivan", 500, "пицца", base.Add(time.Hour)),
+		payback("olga", "anna", 200, base.Add(time.Hour)),
+	}
+	if got := strip(op.Entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("LastOperation entries:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func testCancelOperation(t *testing.T, s storage.Store) {
+	first := save(t, s, chatID, "", nil, debt("anna", "ivan", 100, "", base))
+	second := save(t, s, chatID, "еда", []string{"пицца"},
+		debt("anna", "ivan", 500, "#пицца", base.Add(time.Hour)),
+		debt("anna", "olga", 500, "#пицца", base.Add(time.Hour)))
+
+	deleted, err := s.CancelOperation(chatID, second)
+	if err != nil || deleted != 2 {
+		t.Fatalf("CancelOperation = %d, %v; want 2 entries deleted", deleted, err)
+	}
+	deleted, err = s.CancelOperation(chatID, second)
+	if err != nil || deleted != 0 {
+		t.Errorf("CancelOperation again = %d, %v; want nothing deleted", deleted, err)
+	}
+	deleted, err = s.CancelOperation(otherChatID, first)
+	if err != nil || deleted != 0 {
+		t.Errorf("CancelOperation in another chat = %d, %v; want nothing deleted", deleted, err)
+	}
+
+	op, err := s.LastOperation(chatID)
+	if err != nil || op.ID != first {
+		t.Errorf("LastOperation after cancel = %d, %v; want %d", op.ID, err, first)
+	}
+	if _, total, err := s.History(chatID, storage.HistoryFilter{Tag: "пицца"}, 0, 10); err != nil || total != 0 {
+		t.Errorf("History of a cancelled tag = %d, %v; want none", total, err)
+	}
+	totals, err := s.CategoryTotals(chatID, time.Time{})
+	if err != nil {
+		t.Fatalf("CategoryTotals: %v", err)
+	}
+	if want := []storage.CategoryTotal{{Category: storage.DefaultCategory, Amount: 100, Operations: 1}}; !reflect.DeepEqual(totals, want) {
+		t.Errorf("CategoryTotals after cancel = %+v, want %+v", totals, want)
+	}
+}
+
+func testMembers(t *testing.T, s storage.Store) {
+	save(t, s, chatID, "", nil, debt("olga", "ivan", 100, "", base), debt("olga", "anna", 100, "", base))
+	save(t, s, chatID, "", nil, payback("ivan", "olga", 100, base))
+	save(t, s, otherChatID, "", nil, debt("boris", "anna", 100, "", base))
+
+	members, err := s.Members(chatID)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if want := []string{"anna", "ivan", "olga"}; !reflect.DeepEqual(members, want) {
+		t.Errorf("Members = %v, want %v", members, want)
+	}
+}
+
+func testCategoryTotals(t *testing.T, s storage.Store) {
+	save(t, s, chatID, "еда", nil, debt("anna", "ivan", 500, "", base), debt("anna", "olga", 500, "", base))
+	save(t, s, chatID, "еда", nil, debt("ivan", "anna", 300, "", base.Add(time.Hour)))
+	save(t, s, chatID, "транспорт", nil, debt("olga", "anna", 2000, "", base.Add(2*time.Hour)))
+	save(t, s, chatID, "", nil, debt("olga", "ivan", 50, "", base.Add(3*time.Hour)))
+	save(t, s, chatID, storage.RepaymentCategory, nil, payback("ivan", "anna", 200, base.Add(4*time.Hour)))
+	// An expense share netted against what the payer owed is still spending
+	save(t, s, chatID, "кафе", nil, payback("anna", "ivan", 50, base.Add(5*time.Hour)), debt("anna", "olga", 50, "", base.Add(5*time.Hour)))
+	save(t, s, otherChatID, "еда", nil, debt("anna", "ivan", 9000, "", base))
+
+	// Repayments are not spending
+	totals, err := s.CategoryTotals(chatID, base)
+	if err != nil {
+		t.Fatalf("CategoryTotals: %v", err)
+	}
+	want := []storage.CategoryTotal{
+		{Category: "транспорт", Amount: 2000, Operations: 1},
+		{Category: "еда", Amount: 1300, Operations: 2},
+		{Category: "кафе", Amount: 100, Operations: 1},
+		{Category: storage.DefaultCategory, Amount: 50, Operations: 1},
+	}
+	if !reflect.DeepEqual(totals, want) {
+		t.Errorf("CategoryTotals = %+v, want %+v", totals, want)
+	}
+
+	totals, err = s.CategoryTotals(chatID, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CategoryTotals: %v", err)
+	}
+	want = []storage.CategoryTotal{
+		{Category: "транспорт", Amount: 2000, Operations: 1},
+		{Category: "еда", Amount: 300, Operations: 1},
+		{Category: "кафе", Amount: 100, Operations: 1},
+		{Category: storage.DefaultCategory, Amount: 50, Operations: 1},
+	}
+	if !reflect.DeepEqual(totals, want) {
+		t.Errorf("CategoryTotals since an hour later = %+v, want %+v", totals, want)
+	}
+}
+
+func testMemberStats(t *testing.T, s storage.Store) {
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 500, "", base), debt("anna", "olga", 500, "", base))
+	save(t, s, chatID, "", nil, debt("ivan", "olga", 300, "", base.Add(time.Hour)))
+	save(t, s, chatID, "", nil, debt("boris", "olga", 200, "", base.Add(-time.Hour)))
+	// A repayment is left out, an expense share netted against a debt is not
+	save(t, s, chatID, storage.RepaymentCategory, nil, payback("olga", "anna", 400, base.Add(2*time.Hour)))
+	save(t, s, chatID, "кафе", nil, payback("ivan", "anna", 100, base.Add(3*time.Hour)))
+	save(t, s, otherChatID, "", nil, debt("olga", "anna", 9000, "", base))
+
+	stats, err := s.MemberStats(chatID, base)
+	if err != nil {
+		t.Fatalf("MemberStats: %v", err)
+	}
+	want := []storage.MemberStats{
+		{User: "anna", Paid: 1000, Consumed: 100},
+		{User: "ivan", Paid: 400, Consumed: 500},
+		{User: "olga", Paid: 0, Consumed: 800},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("MemberStats = %+v, want %+v", stats, want)
+	}
+}
+
+func testLargestExpenses(t *testing.T, s storage.Store) {
+	pizza := save(t, s, chatID, "", nil,
+		debt("anna", "ivan", 500, "пицца", base.Add(time.Minute)),
+		debt("anna", "olga", 500, "пицца", base))
+	taxi := save(t, s, chatID, "", nil, debt("ivan", "anna", 1500, "такси", base.Add(time.Hour)))
+	coffee := save(t, s, chatID, "", nil, debt("olga", "anna", 200, "", base.Add(2*time.Hour)))
+	save(t, s, chatID, "", nil, debt("boris", "anna", 5000, "старое", base.Add(-time.Hour)))
+	save(t, s, chatID, storage.RepaymentCategory, nil, payback("olga", "anna", 3000, base.Add(3*time.Hour)))
+
+	expenses, err := s.LargestExpenses(chatID, base, 2)
+	if err != nil {
+		t.Fatalf("LargestExpenses: %v", err)
+	}
+	want := []storage.Expense{
+		{OperationID: taxi, From: "ivan", Amount: 1500, Reason: "такси", Time: base.Add(time.Hour)},
+		{OperationID: pizza, From: "anna", Amount: 1000, Reason: "пицца", Time: base},
+	}
+	if !reflect.DeepEqual(expenses, want) {
+		t.Errorf("LargestExpenses = %+v, want %+v", expenses, want)
+	}
+
+	expenses, err = s.LargestExpenses(chatID, base, 10)
+	if err != nil {
+		t.Fatalf("LargestExpenses: %v", err)
+	}
+	if len(expenses) != 3 || expenses[2].OperationID != coffee || expenses[2].Reason != "" {
+		t.Errorf("LargestExpenses without a limit = %+v, want coffee last", expenses)
+	}
+}
+
+func testBusiestDays(t *testing.T, s storage.Store) {
+	// 22:30 UTC is already the next day in Moscow
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 100, "", base))
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 200, "", base.Add(time.Hour)), debt("anna", "olga", 200, "", base.Add(time.Hour)))
+	save(t, s, chatID, "", nil, debt("ivan", "anna", 700, "", base.Add(10*time.Hour+30*time.Minute)))
+	save(t, s, chatID, "", nil, debt("ivan", "anna", 50, "", base.Add(24*time.Hour)))
+	save(t, s, chatID, storage.RepaymentCategory, nil,
+		payback("olga", "anna", 100, base.Add(25*time.Hour)), payback("ivan", "anna", 100, base.Add(26*time.Hour)))
+
+	stats, err := s.BusiestDays(chatID, base, time.UTC, 10)
+	if err != nil {
+		t.Fatalf("BusiestDays: %v", err)
+	}
+	want := []storage.DayStats{
+		{Day: "2024-03-10", Operations: 3, Amount: 1200},
+		{Day: "2024-03-11", Operations: 1, Amount: 50},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("BusiestDays in UTC = %+v, want %+v", stats, want)
+	}
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	stats, err = s.BusiestDays(chatID, base, moscow, 1)
+	if err != nil {
+		t.Fatalf("BusiestDays: %v", err)
+	}
+	want = []storage.DayStats{{Day: "2024-03-11", Operations: 2, Amount: 750}}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("BusiestDays in Moscow = %+v, want %+v", stats, want)
+	}
+
+	// Berlin moves from UTC+1 to UTC+2 on 2024-03-31, so no single offset
+	// puts both of these on their local day
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	winter := time.Date(2024, 3, 30, 22, 30, 0, 0, time.UTC)
+	summer := time.Date(2024, 4, 1, 22, 30, 0, 0, time.UTC)
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 300, "", winter))
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 200, "", summer))
+	stats, err = s.BusiestDays(chatID, winter, berlin, 10)
+	if err != nil {
+		t.Fatalf("BusiestDays: %v", err)
+	}
+	want = []storage.DayStats{
+		{Day: "2024-03-30", Operations: 1, Amount: 300},
+		{Day: "2024-04-02", Operations: 1, Amount: 200},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("BusiestDays across daylight saving time = %+v, want %+v", stats, want)
+	}
+}
+
+func testChatTimezone(t *testing.T, s storage.Store) {
+	name, err := s.ChatTimezone(chatID)
+	if err != nil || name != "" {
+		t.Fatalf("ChatTimezone of a new chat = %q, %v; want none", name, err)
+	}
+	if err := s.SetChatTimezone(chatID, "Europe/Moscow"); err != nil {
+		t.Fatalf("SetChatTimezone: %v", err)
+	}
+	if err := s.SetChatTimezone(chatID, "Asia/Yekaterinburg"); err != nil {
+		t.Fatalf("SetChatTimezone: %v", err)
+	}
+	name, err = s.ChatTimezone(chatID)
+	if err != nil || name != "Asia/Yekaterinburg" {
+		t.Errorf("ChatTimezone = %q, %v; want Asia/Yekaterinburg", name, err)
+	}
+	if name, err := s.ChatTimezone(otherChatID); err != nil || name != "" {
+		t.Errorf("ChatTimezone of another chat = %q, %v; want none", name, err)
+	}
+}
+
+func testChatLanguage(t *testing.T, s storage.Store) {
+	code, err := s.ChatLanguage(chatID)
+	if err != nil || code != "" {
+		t.Fatalf("ChatLanguage of a new chat = %q, %v; want none", code, err)
+	}
+	if err := s.SetChatTimezone(chatID, "Europe/Moscow"); err != nil {
+		t.Fatalf("SetChatTimezone: %v", err)
+	}
+	if err := s.SetChatLanguage(chatID, "en"); err != nil {
+		t.Fatalf("SetChatLanguage: %v", err)
+	}
+	if code, err := s.ChatLanguage(chatID); err != nil || code != "en" {
+		t.Errorf("ChatLanguage = %q, %v; want en", code, err)
+	}
+	// Settings of a chat are stored together but set independently
+	if name, err := s.ChatTimezone(chatID); err != nil || name != "Europe/Moscow" {
+		t.Errorf("ChatTimezone after SetChatLanguage = %q, %v; want Europe/Moscow", name, err)
+	}
+	if code, err := s.ChatLanguage(otherChatID); err != nil || code != "" {
+		t.Errorf("ChatLanguage of another chat = %q, %v; want none", code, err)
+	}
+}
+
+func testUserGender(t *testing.T, s storage.Store) {
+	gender, err := s.UserGender("anna")
+	if err != nil || gender != storage.GenderUnset {
+		t.Fatalf("UserGender of a new user = %q, %v; want unset", gender, err)
+	}
+	if err := s.SetUserGender("anna", storage.GenderNeutral); err != nil {
+		t.Fatalf("SetUserGender: %v", err)
+	}
+	if err := s.SetUserGender("anna", storage.GenderFemale); err != nil {
+		t.Fatalf("SetUserGender: %v", err)
+	}
+	if gender, err := s.UserGender("anna"); err != nil || gender != storage.GenderFemale {
+		t.Errorf("UserGender = %q, %v; want f", gender, err)
+	}
+	if gender, err := s.UserGender("ivan"); err != nil || gender != storage.GenderUnset {
+		t.Errorf("UserGender of another user = %q, %v; want unset", gender, err)
+	}
+}
+
+func testUserChats(t *testing.T, s storage.Store) {
+	const thirdChatID int64 = -300
+	save(t, s, chatID, "", nil, debt("anna", "ivan", 100, "", base))
+	save(t, s, otherChatID, "", nil, debt("olga", "anna", 100, "", base))
+	save(t, s, thirdChatID, "", nil, debt("olga", "boris", 100, "", base))
+	for _, chat := range []storage.Chat{
+		{ID: chatID, Title: "Дача", LastMessageID: 5},
+		{ID: otherChatID, Title: "Бар", Username: "bar_chat", LastMessageID: 7},
+		{ID: thirdChatID, Title: "Арбат", LastMessageID: 9},
+	} {
+		if err := s.SaveChat(chat); err != nil {
+			t.Fatalf("SaveChat: %v", err)
+		}
+	}
+	if err := s.SaveChat(storage.Chat{ID: chatID, Title: "Дача 2026", LastMessageID: 6}); err != nil {
+		t.Fatalf("SaveChat: %v", err)
+	}
+
+	chats, err := s.UserChats([]string{"anna", "nobody"})
+	if err != nil {
+		t.Fatalf("UserChats: %v", err)
+	}
+	want := []storage.Chat{
+		{ID: otherChatID, Title: "Бар", Username: "bar_chat", LastMessageID: 7},
+		{ID: chatID, Title: "Дача 2026", LastMessageID: 6},
+	}
+	if !reflect.DeepEqual(chats, want) {
+		t.Errorf("UserChats = %+v, want %+v", chats, want)
+	}
+	if chats, err := s.UserChats(nil); err != nil || len(chats) != 0 {
+		t.Errorf("UserChats of nobody = %+v, %v; want none", chats, err)
+	}
+
+	if chat, err := s.Chat(otherChatID); err != nil || chat != want[0] {
+		t.Errorf("Chat = %+v, %v; want %+v", chat, err, want[0])
+	}
+	if _, err := s.Chat(-400); err != storage.ErrNotFound {
+		t.Errorf("Chat of an unknown chat: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUsernames(t *testing.T, s storage.Store) {
+	for _, name := range []string{"anna", "anna_k", "anna"} {
+		if err := s.SaveUsername(1, name); err != nil {
+			t.Fatalf("SaveUsername: %v", err)
+		}
+	}
+	// A username given up by one user and taken by another moves with it
+	if err := s.SaveUsername(2, "anna_k"); err != nil {
+		t.Fatalf("SaveUsername: %v", err)
+	}
+
+	if names, err := s.Usernames(1); err != nil || !reflect.DeepEqual(names, []string{"anna"}) {
+		t.Errorf("Usernames(1) = %v, %v; want [anna]", names, err)
+	}
+	if names, err := s.Usernames(2); err != nil || !reflect.DeepEqual(names, []string{"anna_k"}) {
+		t.Errorf("Usernames(2) = %v, %v; want [anna_k]", names, err)
+	}
+	if names, err := s.Usernames(3); err != nil || len(names) != 0 {
+		t.Errorf("Usernames of an unknown user = %v, %v; want none", names, err)
+	}
+
+	if id, err := s.UserID("anna_k"); err != nil || id != 2 {
+		t.Errorf("UserID(anna_k) = %d, %v; want 2", id, err)
+	}
+	if id, err := s.UserID("nobody"); err != nil || id != 0 {
+		t.Errorf("UserID of an unknown username = %d, %v; want 0", id, err)
+	}
+}
+
+func testNotifications(t *testing.T, s storage.Store) {
+	if mode, err := s.NotifyMode(1); err != nil || mode != storage.NotifyUnset {
+		t.Fatalf("NotifyMode of a new user = %q, %v; want unset", mode, err)
+	}
+	if err := s.SetNotifyMode(1, storage.NotifyNow); err != nil {
+		t.Fatalf("SetNotifyMode: %v", err)
+	}
+	if err := s.SetNotifyMode(1, storage.NotifyDaily); err != nil {
+		t.Fatalf("SetNotifyMode: %v", err)
+	}
+	if mode, err := s.NotifyMode(1); err != nil || mode != storage.NotifyDaily {
+		t.Errorf("NotifyMode = %q, %v; want daily", mode, err)
+	}
+
+	for _, n := range []struct {
+		userID int64
+		text   string
+	}{{1, "first"}, {2, "other"}, {1, "second"}, {3, "dropped"}} {
+		if err := s.QueueNotification(n.userID, n.text); err != nil {
+			t.Fatalf("QueueNotification: %v", err)
+		}
+	}
+	if err := s.DropNotifications(3); err != nil {
+		t.Fatalf("DropNotifications: %v", err)
+	}
+
+	notifications, err := s.TakeNotifications()
+	if err != nil {
+		t.Fatalf("TakeNotifications: %v", err)
+	}
+	want := map[int64][]string{1: {"first", "second"}, 2: {"other"}}
+	if !reflect.DeepEqual(notifications, want) {
+		t.Errorf("TakeNotifications = %v, want %v", notifications, want)
+	}
+	if notifications, err := s.TakeNotifications(); err != nil || len(notifications) != 0 {
+		t.Errorf("TakeNotifications after taking = %v, %v; want none", notifications, err)
+	}
+}
+
+func testReminders(t *testing.T, s storage.Store) {
+	if _, err := s.Reminder(chatID); err != storage.ErrNotFound {
+		t.Fatalf("Reminder of a new chat: err = %v, want ErrNotFound", err)
+	}
+
+	weekly := storage.Reminder{ChatID: chatID, Frequency: storage.Weekly, MinAge: 7, NextRun: base.Add(48 * time.Hour)}
+	daily := storage.Reminder{ChatID: otherChatID, Frequency: storage.Daily, MinAge: 3, Direct: true, NextRun: base}
+	for _, reminder := range []storage.Reminder{{ChatID: chatID, Frequency: storage.Daily, NextRun: base}, weekly, daily} {
+		if err := s.SaveReminder(reminder); err != nil {
+			t.Fatalf("SaveReminder: %v", err)
+		}
+	}
+
+	got, err := s.Reminder(chatID)
+	if err != nil {
+		t.Fatalf("Reminder: %v", err)
+	}
+	if got.Frequency != weekly.Frequency || got.MinAge != weekly.MinAge || got.Direct || !got.NextRun.Equal(weekly.NextRun) {
+		t.Errorf("Reminder = %+v, want %+v", got, weekly)
+	}
+
+	due, err := s.DueReminders(base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("DueReminders: %v", err)
+	}
+	if len(due) != 1 || due[0].ChatID != otherChatID || !due[0].Direct {
+		t.Errorf("DueReminders = %+v, want only the reminder of the other chat", due)
+	}
+	due, err = s.DueReminders(base.Add(48 * time.Hour))
+	if err != nil {
+		t.Fatalf("DueReminders: %v", err)
+	}
+	if len(due) != 2 || due[0].ChatID != otherChatID || due[1].ChatID != chatID {
+		t.Errorf("DueReminders = %+v, want both reminders, earliest first", due)
+	}
+
+	if err := s.DeleteReminder(chatID); err != nil {
+		t.Fatalf("DeleteReminder: %v", err)
+	}
+	if _, err := s.Reminder(chatID); err != storage.ErrNotFound {
+		t.Errorf("Reminder after DeleteReminder: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testRecurring(t *testing.T, s storage.Store) {
+	rent := storage.Recurring{ChatID: chatID, Author: "anna", Frequency: storage.Monthly, Day: 1, Text: "@all 45000 аренда", NextRun: base.Add(24 * time.Hour)}
+	internet := storage.Recurring{ChatID: chatID, Author: "ivan", Frequency: storage.Weekly, Day: 5, Text: "@anna 500 интернет", NextRun: base}
+	other := storage.Recurring{ChatID: otherChatID, Author: "olga", Frequency: storage.Daily, Text: "@boris 100 кофе", NextRun: base}
+	for _, recurring := range []*storage.Recurring{&rent, &internet, &other} {
+		id, err := s.AddRecurring(*recurring)
+		if err != nil {
+			t.Fatalf("AddRecurring: %v", err)
+		}
+		recurring.ID = id
+	}
+	if rent.ID == internet.ID || internet.ID == other.ID {
+		t.Fatalf("AddRecurring returned IDs %d, %d, %d; want distinct", rent.ID, internet.ID, other.ID)
+	}
+
+	recurrings, err := s.Recurrings(chatID)
+	if err != nil {
+		t.Fatalf("Recurrings: %v", err)
+	}
+	if len(recurrings) != 2 || recurrings[0].ID != rent.ID || recurrings[1].ID != internet.ID {
+		t.Fatalf("Recurrings = %+v, want rent and internet", recurrings)
+	}
+	got := recurrings[0]
+	if got.Author != rent.Author || got.Frequency != rent.Frequency || got.Day != rent.Day || got.Text != rent.Text ||
+		got.Paused || !got.NextRun.Equal(rent.NextRun) {
+		t.Errorf("Recurrings[0] = %+v, want %+v", got, rent)
+	}
+
+	// Pausing from another chat does nothing
+	internet.Paused = true
+	if ok, err := s.UpdateRecurring(storage.Recurring{ID: internet.ID, ChatID: otherChatID, Paused: true}); err != nil || ok {
+		t.Errorf("UpdateRecurring in another chat = %v, %v; want false", ok, err)
+	}
+	if ok, err := s.UpdateRecurring(internet); err != nil || !ok {
+		t.Errorf("UpdateRecurring = %v, %v; want true", ok, err)
+	}
+
+	due, err := s.DueRecurrings(base.Add(24 * time.Hour))
+	if err != nil {
+		t.Fatalf("DueRecurrings: %v", err)
+	}
+	if len(due) != 2 || due[0].ID != other.ID || due[1].ID != rent.ID {
+		t.Errorf("DueRecurrings = %+v, want other and rent, earliest first", due)
+	}
+
+	if ok, err := s.DeleteRecurring(otherChatID, rent.ID); err != nil || ok {
+		t.Errorf("DeleteRecurring in another chat = %v, %v; want false", ok, err)
+	}
+	if ok, err := s.DeleteRecurring(chatID, rent.ID); err != nil || !ok {
+		t.Errorf("DeleteRecurring = %v, %v; want true", ok, err)
+	}
+	recurrings, err = s.Recurrings(chatID)
+	if err != nil || len(recurrings) != 1 || !recurrings[0].Paused {
+		t.Errorf("Recurrings after DeleteRecurring = %+v, %v; want only the paused internet", recurrings, err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxDownloadSize is the largest file the Bot API lets bots download
+const maxDownloadSize = 20 << 20
+
+// telegramClient is the part of the Bot API the bot uses. botClient
+// implements it; tests point one at telegramtest.Server.
+type telegramClient interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	GetChatAdministrators(config tgbotapi.ChatAdministratorsConfig) ([]tgbotapi.ChatMember, error)
+	DownloadFile(fileID string) ([]byte, error)
+	PollUpdates(ctx context.Context, config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error)
+}
+
+// botClient is a Bot API client that downloads files from the server it was
+// created for. tgbotapi always links files to api.telegram.org.
+type botClient struct {
+	*tgbotapi.BotAPI
+	apiEndpoint  string
+	fileEndpoint string
+}
+
+// newBotClient wraps a client created with the given API endpoint, whose
+// files are served under /file/bot<token>/<path> on the same server
+func newBotClient(bot *tgbotapi.BotAPI, apiEndpoint string) botClient {
+	return botClient{BotAPI: bot, apiEndpoint: apiEndpoint, fileEndpoint: strings.Replace(apiEndpoint, "/bot%s/", "/file/bot%s/", 1)}
+}
+
+// PollUpdates is GetUpdates giving up when ctx is done, so polling stops
+// without waiting for a long poll to time out
+func (c botClient) PollUpdates(ctx context.Context, config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+	values := url.Values{}
+	for name, value := range map[string]int{"offset": config.Offset, "limit": config.Limit, "timeout": config.Timeout} {
+		if value != 0 {
+			values.Set(name, strconv.Itoa(value))
+		}
+	}
+	if len(config.AllowedUpdates) > 0 {
+		allowed, err := json.Marshal(config.AllowedUpdates)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("allowed_updates", string(allowed))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(c.apiEndpoint, c.Token, "getUpdates"), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp tgbotapi.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, err
+	}
+	if !apiResp.Ok {
+		return nil, &tgbotapi.Error{Code: apiResp.ErrorCode, Message: apiResp.Description}
+	}
+	var updates []tgbotapi.Update
+	err = json.Unmarshal(apiResp.Result, &updates)
+	return updates, err
+}
+
+// DownloadFile fetches the contents of a file uploaded to Telegram
+func (c botClient) DownloadFile(fileID string) ([]byte, error) {
+	file, err := c.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(fmt.Sprintf(c.fileEndpoint, c.Token, file.FilePath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
@@ -0,0 +1,427 @@
+// Package telegramtest is a fake Telegram Bot API server for end-to-end
+// tests. Point a real client at it and script a conversation:
+//
+//	server := telegramtest.NewServer()
+//	defer server.Close()
+//	bot, _ := server.NewBot()
+//	server.SetAdministrators(chat.ID, anna, ivan)
+//	handleUpdate(bot, server.Message(chat, anna, "@ivan 50 обед"))
+//	handleUpdate(bot, server.Message(chat, anna, "/balance"))
+//	replies := server.Replies(chat.ID)
+//
+// Updates queued with Push are served to getUpdates, so the polling loop can
+// be exercised as well; Offsets shows which updates it confirmed. Files sent
+// with Document can be downloaded through getFile and the
+// /file/bot<token>/<path> endpoint.
+package telegramtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the only bot token the server accepts
+const Token = "123456:TEST-TOKEN"
+
+// maxPollWait caps how long getUpdates waits for new updates
+const maxPollWait = time.Second
+
+// Call is a request the bot made to the server
+type Call struct {
+	Method string
+	Params url.Values
+	Files  map[string][]byte // uploaded files by field name
+}
+
+// ChatID returns the chat the call was addressed to, or 0
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// Text returns the text or caption of a sent or edited message
+func (c Call) Text() string {
+	if text := c.Params.Get("text"); text != "" {
+		return text
+	}
+	return c.Params.Get("caption")
+}
+
+// Server is a fake Bot API server. It is safe for concurrent use.
+type Server struct {
+	server *httptest.Server
+	closed chan struct{}
+	// Bot is the account returned by getMe
+	Bot tgbotapi.User
+
+	mu            sync.Mutex
+	admins        map[int64][]tgbotapi.ChatMember
+	files         map[string][]byte // uploaded files by file ID
+	updates       []tgbotapi.Update
+	pushed        chan struct{} // closed and replaced whenever updates are pushed
+	lastUpdateID  int
+	lastMessageID int
+	calls         []Call
+	offsets       []int // offsets of the getUpdates requests
+}
+
+// NewServer starts a fake Bot API server
+func NewServer() *Server {
+	s := &Server{
+		closed: make(chan struct{}),
+		pushed: make(chan struct{}),
+		admins: make(map[int64][]tgbotapi.ChatMember),
+		files:  make(map[string][]byte),
+		Bot:    tgbotapi.User{ID: 1, IsBot: true, FirstName: "Obshyak", UserName: "obshyak_test_bot"},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint returns the API endpoint to pass to tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *Server) Endpoint() string {
+	return s.server.URL + "/bot%s/%s"
+}
+
+// NewBot returns a client connected to the server
+func (s *Server) NewBot() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.Endpoint())
+}
+
+// Close shuts the server down, ending pending getUpdates requests
+func (s *Server) Close() {
+	close(s.closed)
+	s.server.Close()
+}
+
+// Group returns a group chat
+func Group(id int64, title string) tgbotapi.Chat {
+	return tgbotapi.Chat{ID: id, Type: "group", Title: title}
+}
+
+// User returns a human user
+func User(id int64, username string) tgbotapi.User {
+	return tgbotapi.User{ID: id, FirstName: username, UserName: username}
+}
+
+// SetAdministrators sets the members returned by getChatAdministrators for a chat
+func (s *Server) SetAdministrators(chatID int64, users ...tgbotapi.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []tgbotapi.ChatMember
+	for i := range users {
+		status := "administrator"
+		if i == 0 {
+			status = "creator"
+		}
+		members = append(members, tgbotapi.ChatMember{User: &users[i], Status: status})
+	}
+	s.admins[chatID] = members
+}
+
+// Message returns an update with a new text message. Commands at the start
+// of the text are marked up like Telegram does, so Message.Command works.
+func (s *Server) Message(chat tgbotapi.Chat, from tgbotapi.User, text string) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessageID++
+	message := &tgbotapi.Message{
+		MessageID: s.lastMessageID,
+		From:      &from,
+		Chat:      &chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: utf16Len(command)}}
+	}
+	return s.newUpdate(tgbotapi.Update{Message: message})
+}
+
+// Document returns an update with a new message carrying a file, which the
+// bot can then download
+func (s *Server) Document(chat tgbotapi.Chat, from tgbotapi.User, name string, data []byte, caption string) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessageID++
+	fileID := "file" + strconv.Itoa(s.lastMessageID)
+	s.files[fileID] = data
+	message := &tgbotapi.Message{
+		MessageID: s.lastMessageID,
+		From:      &from,
+		Chat:      &chat,
+		Date:      int(time.Now().Unix()),
+		Document: &tgbotapi.Document{
+			FileID:       fileID,
+			FileUniqueID: fileID,
+			FileName:     name,
+			FileSize:     len(data),
+		},
+		Caption: caption,
+	}
+	if strings.HasPrefix(caption, "/") {
+		command := strings.SplitN(caption, " ", 2)[0]
+		message.CaptionEntities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: utf16Len(command)}}
+	}
+	return s.newUpdate(tgbotapi.Update{Message: message})
+}
+
+// SetFile makes the contents of a file available for download under a file ID
+func (s *Server) SetFile(fileID string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileID] = data
+}
+
+// Callback returns an update with a press of an inline button under message
+func (s *Server) Callback(message tgbotapi.Message, from tgbotapi.User, data string) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query := &tgbotapi.CallbackQuery{
+		ID:      strconv.Itoa(s.lastUpdateID + 1),
+		From:    &from,
+		Message: &message,
+		Data:    data,
+	}
+	return s.newUpdate(tgbotapi.Update{CallbackQuery: query})
+}
+
+// newUpdate assigns the next update ID; s.mu must be held
+func (s *Server) newUpdate(update tgbotapi.Update) tgbotapi.Update {
+	s.lastUpdateID++
+	update.UpdateID = s.lastUpdateID
+	return update
+}
+
+// Push queues updates for getUpdates
+func (s *Server) Push(updates ...tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, updates...)
+	close(s.pushed)
+	s.pushed = make(chan struct{})
+}
+
+// Calls returns every request made to the server so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Replies returns the texts and captions sent or edited in a chat since the
+// last Reset, oldest first
+func (s *Server) Replies(chatID int64) []string {
+	var replies []string
+	for _, call := range s.Calls() {
+		switch call.Method {
+		case "sendMessage", "sendPhoto", "sendDocument", "editMessageText":
+			if call.ChatID() == chatID {
+				replies = append(replies, call.Text())
+			}
+		}
+	}
+	return replies
+}
+
+// Offsets returns the offset of every getUpdates request since the last
+// Reset, oldest first. Telegram forgets the updates before an offset.
+func (s *Server) Offsets() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.offsets...)
+}
+
+// Reset forgets the recorded calls and getUpdates offsets
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+	s.offsets = nil
+}
+
+// response is the envelope of every Bot API response
+type response struct {
+	OK          bool        `json:"ok"`
+	Result      interface{} `json:"result,omitempty"`
+	ErrorCode   int         `json:"error_code,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"+Token+"/"); ok {
+		s.serveFile(w, path)
+		return
+	}
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || token != Token {
+		writeResponse(w, response{ErrorCode: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+
+	call := Call{Method: method, Params: url.Values{}}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			writeResponse(w, response{ErrorCode: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+			return
+		}
+		call.Params = url.Values(r.MultipartForm.Value)
+		call.Files = make(map[string][]byte)
+		for field, headers := range r.MultipartForm.File {
+			file, err := headers[0].Open()
+			if err != nil {
+				continue
+			}
+			call.Files[field], _ = io.ReadAll(file)
+			file.Close()
+		}
+	} else if err := r.ParseForm(); err == nil {
+		call.Params = r.PostForm
+	}
+
+	if method == "getUpdates" {
+		writeResponse(w, response{OK: true, Result: s.getUpdates(call.Params)})
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	_, known := s.files[call.Params.Get("file_id")]
+	result, handled := s.result(call)
+	s.mu.Unlock()
+	if method == "getFile" && !known {
+		writeResponse(w, response{ErrorCode: http.StatusBadRequest, Description: "Bad Request: invalid file_id"})
+		return
+	}
+	if !handled {
+		writeResponse(w, response{ErrorCode: http.StatusNotFound, Description: "Not Found: method " + method + " is not supported by telegramtest"})
+		return
+	}
+	writeResponse(w, response{OK: true, Result: result})
+}
+
+// result answers a call other than getUpdates; s.mu must be held
+func (s *Server) result(call Call) (interface{}, bool) {
+	switch call.Method {
+	case "getMe":
+		return s.Bot, true
+	case "sendMessage", "sendPhoto", "sendDocument":
+		s.lastMessageID++
+		return tgbotapi.Message{
+			MessageID: s.lastMessageID,
+			From:      &s.Bot,
+			Chat:      &tgbotapi.Chat{ID: call.ChatID()},
+			Date:      int(time.Now().Unix()),
+			Text:      call.Params.Get("text"),
+			Caption:   call.Params.Get("caption"),
+		}, true
+	case "editMessageText":
+		id, _ := strconv.Atoi(call.Params.Get("message_id"))
+		return tgbotapi.Message{
+			MessageID: id,
+			From:      &s.Bot,
+			Chat:      &tgbotapi.Chat{ID: call.ChatID()},
+			Date:      int(time.Now().Unix()),
+			Text:      call.Params.Get("text"),
+		}, true
+	case "answerCallbackQuery", "setWebhook", "deleteWebhook":
+		return true, true
+	case "getFile":
+		fileID := call.Params.Get("file_id")
+		data := s.files[fileID]
+		return tgbotapi.File{FileID: fileID, FileUniqueID: fileID, FileSize: len(data), FilePath: filePathPrefix + fileID}, true
+	case "getChatAdministrators":
+		admins := s.admins[call.ChatID()]
+		if admins == nil {
+			admins = []tgbotapi.ChatMember{}
+		}
+		return admins, true
+	}
+	return nil, false
+}
+
+// filePathPrefix starts the paths getFile returns
+const filePathPrefix = "documents/"
+
+// serveFile answers a download of a file returned by getFile
+func (s *Server) serveFile(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	data, ok := s.files[strings.TrimPrefix(path, filePathPrefix)]
+	s.mu.Unlock()
+	if !ok || !strings.HasPrefix(path, filePathPrefix) {
+		http.NotFound(w, nil)
+		return
+	}
+	w.Write(data)
+}
+
+// getUpdates confirms the updates before offset and returns the rest,
+// waiting up to the requested timeout for new ones
+func (s *Server) getUpdates(params url.Values) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+	wait := time.Duration(timeout) * time.Second
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	s.mu.Lock()
+	s.offsets = append(s.offsets, offset)
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		pending := s.updates[:0]
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+		result := append([]tgbotapi.Update{}, pending...)
+		pushed := s.pushed
+		s.mu.Unlock()
+
+		if len(result) > 0 {
+			return result
+		}
+		select {
+		case <-pushed:
+		case <-deadline.C:
+			return result
+		case <-s.closed:
+			return result
+		}
+	}
+}
+
+func writeResponse(w http.ResponseWriter, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which is how
+// Telegram measures entity offsets
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	// Embed the time zone database so that /timezone works on hosts without one
+	_ "time/tzdata"
+)
+
+// getChatLocation returns the time zone a chat renders times in, defaulting to the server's zone
+func getChatLocation(chatID int64) *time.Location {
+	name, err := store.ChatTimezone(chatID)
+	if err != nil {
+		log.Printf("Error getting chat time zone: %v", err)
+		return time.Local
+	}
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Error loading time zone '%s': %v", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+// setChatTimezone stores the time zone of a chat
+func setChatTimezone(chatID int64, name string) error {
+	return store.SetChatTimezone(chatID, name)
+}
+
+// clock returns the current time. Handlers read it instead of time.Now, so
+// that a replay can set it to when each recorded update came in.
+var clock = time.Now
+
+// periodStart returns the beginning of a period of n calendar days ending
+// today in the given zone, so a period of 1 day starts at local midnight.
+func periodStart(loc *time.Location, days int) time.Time {
+	now := clock().In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	return midnight.AddDate(0, 0, -(days - 1))
+}
+
+// dateOf returns the calendar day of t in its own zone at midnight UTC, the
+// way due dates are kept, so that days compare regardless of zones
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader carries the secret token Telegram was given in setWebhook
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookConfig describes how the bot receives updates in webhook mode
+type webhookConfig struct {
+	Listen      string `yaml:"listen"`       // address to listen on, e.g. ":8443"; empty means long polling
+	PathSecret  string `yaml:"path_secret"`  // secret path the updates are posted to
+	SecretToken string `yaml:"secret_token"` // expected in X-Telegram-Bot-Api-Secret-Token if set
+	CertFile    string `yaml:"cert_file"`    // TLS certificate, if the bot terminates TLS itself
+	KeyFile     string `yaml:"key_file"`
+	PublicURL   string `yaml:"public_url"` // if set, the webhook is registered at PublicURL/PathSecret on start
+}
+
+// path returns the URL path updates are posted to
+func (c webhookConfig) path() string {
+	return "/" + strings.Trim(c.PathSecret, "/")
+}
+
+// listenForWebhook registers the webhook if a public URL is configured and
+// starts serving it. Requests without the right secret token are rejected
+// before they reach the update handler.
+func listenForWebhook(bot *tgbotapi.BotAPI, config webhookConfig) (tgbotapi.UpdatesChannel, *http.Server, error) {
+	if config.PublicURL != "" {
+		if err := setWebhook(bot, config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Only the webhook is served, not whatever else registered itself on
+	// http.DefaultServeMux, as bot.ListenForWebhook would
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(config.path(), webhookHandler(bot, updates))
+	server := &http.Server{
+		Addr:    config.Listen,
+		Handler: requireSecretToken(config.SecretToken, mux),
+	}
+	go func() {
+		var err error
+		if config.CertFile != "" {
+			err = server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error serving webhook: %v", err)
+		}
+	}()
+	logf(levelInfo, "Listening for webhook updates on %s", config.Listen)
+	return updates, server, nil
+}
+
+// webhookHandler passes the updates posted to the webhook to updates
+func webhookHandler(bot *tgbotapi.BotAPI, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		update, err := bot.HandleUpdate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates <- *update
+	})
+}
+
+// setWebhook points Telegram at the webhook. tgbotapi's WebhookConfig has
+// no secret token, so the request is built by hand.
+func setWebhook(bot *tgbotapi.BotAPI, config webhookConfig) error {
+	link, err := url.JoinPath(config.PublicURL, config.path())
+	if err != nil {
+		return err
+	}
+	params := tgbotapi.Params{"url": link}
+	params.AddNonEmpty("secret_token", config.SecretToken)
+
+	if config.CertFile != "" {
+		// Uploading the certificate lets Telegram trust a self-signed one
+		files := []tgbotapi.RequestFile{{Name: "certificate", Data: tgbotapi.FilePath(config.CertFile)}}
+		_, err = bot.UploadFiles("setWebhook", params, files)
+	} else {
+		_, err = bot.MakeRequest("setWebhook", params)
+	}
+	return err
+}
+
+// requireSecretToken rejects requests that do not carry the expected secret
+// token. An empty token disables the check.
+func requireSecretToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}